@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"strings"
+	"time"
+)
+
+func validateBookmarkAlias(alias string) error {
+	if alias == "" || strings.ContainsAny(alias, "/ \t\n") {
+		return fmt.Errorf("Invalid bookmark alias %q, it must be non-empty and contain no slashes or whitespace", alias)
+	}
+	return nil
+}
+
+func decodeBookmarkEntry(k, v []byte) (BookmarkEntry, error) {
+	e := BookmarkEntry{Alias: string(k)}
+	if err := json.Unmarshal(v, &e); err != nil {
+		return e, fmt.Errorf("Bad bookmark %q: %s", k, err)
+	}
+	return e, nil
+}
+
+// getBookmarkList returns all bookmarks sorted by alias.
+func getBookmarkList(tx *bbolt.Tx) ([]BookmarkEntry, error) {
+	var out []BookmarkEntry
+	err := tx.Bucket(BUCKET_BOOKMARKS).ForEach(func(k, v []byte) error {
+		e, err := decodeBookmarkEntry(k, v)
+		if err != nil {
+			return err
+		}
+		out = append(out, e)
+		return nil
+	})
+	return out, err
+}
+
+// getBookmarkedPaths returns a set of bookmarked directories. History entries
+// of these directories are never removed automatically.
+func getBookmarkedPaths(tx *bbolt.Tx) (map[string]bool, error) {
+	list, err := getBookmarkList(tx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(list))
+	for _, e := range list {
+		out[e.Path] = true
+	}
+	return out, nil
+}
+
+// pinBookmarks moves bookmarked directories to the top of a sorted list,
+// ordered by alias. If addMissing is true, bookmarks which are not in the
+// list are added as well.
+func pinBookmarks(db *bbolt.DB, list []DirectoryEntry, addMissing bool) []DirectoryEntry {
+	var bookmarks []BookmarkEntry
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		var err error
+		bookmarks, err = getBookmarkList(tx)
+		return err
+	}))
+	if len(bookmarks) == 0 {
+		return list
+	}
+
+	index := make(map[string]int, len(list))
+	for i, e := range list {
+		index[string(e.Path)] = i
+	}
+	out := make([]DirectoryEntry, 0, len(list)+len(bookmarks))
+	pinned := map[string]bool{}
+	for _, b := range bookmarks {
+		if pinned[b.Path] {
+			continue
+		}
+		if i, ok := index[b.Path]; ok {
+			out = append(out, list[i])
+		} else if addMissing {
+			out = append(out, DirectoryEntry{Path: []byte(b.Path), AccessTime: b.Created})
+		} else {
+			continue
+		}
+		pinned[b.Path] = true
+	}
+	for _, e := range list {
+		if !pinned[string(e.Path)] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func commandBookmarkAdd(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir bookmark add", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir bookmark add <alias> [directory]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nBookmark a directory under a short alias. If directory is missing, the current directory is used. An existing bookmark with the same alias is replaced. Bookmarked directories are listed first by `changedir list` and are never removed from history by prune or ignore apply.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	alias := cmd.Arg(0)
+	if alias == "" {
+		cmd.Usage()
+		return
+	}
+	fatal(validateBookmarkAlias(alias))
+	dir := cmd.Arg(1)
+	if dir == "" {
+		dir = "."
+	}
+	e := BookmarkEntry{
+		Alias:   alias,
+		Path:    fatalr(canonicalPath(dir, getResolveSymlinks(db))),
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+	v := fatalr(json.Marshal(&e))
+	fatal(db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(BUCKET_BOOKMARKS).Put([]byte(alias), v)
+	}))
+}
+
+func commandBookmarkList(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir bookmark list", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir bookmark list\n")
+		fmt.Fprintf(cmd.Output(), ww("\nList all bookmarks, one per line: alias and directory (tab separated).\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	var list []BookmarkEntry
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		var err error
+		list, err = getBookmarkList(tx)
+		return err
+	}))
+	w := bufio.NewWriter(os.Stdout)
+	for _, e := range list {
+		fatalr(w.WriteString(e.Alias))
+		fatal(w.WriteByte('\t'))
+		fatalr(w.WriteString(e.Path))
+		fatal(w.WriteByte('\n'))
+	}
+	fatal(w.Flush())
+}
+
+func commandBookmarkRemove(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir bookmark remove", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir bookmark remove <alias>\n")
+		fmt.Fprintf(cmd.Output(), ww("\nRemove a bookmark. The directory stays in history.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	alias := cmd.Arg(0)
+	if alias == "" {
+		// do nothing
+		return
+	}
+	fatal(db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(BUCKET_BOOKMARKS).Delete([]byte(alias))
+	}))
+}
+
+func commandResolve(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir resolve", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir resolve <alias>\n")
+		fmt.Fprintf(cmd.Output(), ww("\nPrint the directory of a bookmark. Fails if there is no such bookmark.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	alias := cmd.Arg(0)
+	if alias == "" {
+		cmd.Usage()
+		os.Exit(2)
+	}
+	var path string
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(BUCKET_BOOKMARKS).Get([]byte(alias))
+		if v == nil {
+			return fmt.Errorf("No bookmark with alias %q", alias)
+		}
+		e, err := decodeBookmarkEntry([]byte(alias), v)
+		path = e.Path
+		return err
+	}))
+	fmt.Println(path)
+}
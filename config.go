@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"strconv"
+)
+
+type ConfigKey struct {
+	Name        string
+	Description string
+	Validate    func(v string) error
+}
+
+var CONFIG_KEYS = []ConfigKey{
+	{
+		Name:        "retention.max-age",
+		Description: "remove directories not visited for this long (e.g. \"180d\"), also removes older visit log entries",
+		Validate:    validateDuration,
+	},
+	{
+		Name:        "retention.max-entries",
+		Description: "keep at most this many directories, least recently visited ones are removed",
+		Validate:    validateUint,
+	},
+	{
+		Name:        "put.resolve-symlinks",
+		Description: "resolve symlinks in directories stored by put (\"true\" or \"false\")",
+		Validate:    validateBool,
+	},
+	{
+		Name:        "project.markers",
+		Description: "comma separated names of files or directories marking project roots (default is \".git,go.mod,package.json,Cargo.toml\"), run `changedir normalize` after changing it to update existing entries",
+		Validate:    validateProjectMarkers,
+	},
+	{
+		Name:        "session.max-age",
+		Description: "remove shell session navigation stacks not used for this long (default is \"7d\")",
+		Validate:    validateDuration,
+	},
+	{
+		Name:        "storage.home-relative",
+		Description: "store directories under $HOME relative to it (as \"~/...\"), so that the database and exports are portable between machines (\"true\" or \"false\"), run `changedir normalize` after changing it to convert existing entries",
+		Validate:    validateBool,
+	},
+}
+
+func validateDuration(v string) error {
+	_, err := parseDuration(v)
+	return err
+}
+
+func validateUint(v string) error {
+	if _, err := strconv.ParseUint(v, 10, 64); err != nil {
+		return fmt.Errorf("Invalid number %q", v)
+	}
+	return nil
+}
+
+func validateBool(v string) error {
+	if _, err := strconv.ParseBool(v); err != nil {
+		return fmt.Errorf("Invalid boolean %q, please, use \"true\" or \"false\"", v)
+	}
+	return nil
+}
+
+func findConfigKey(name string) (*ConfigKey, error) {
+	for i := range CONFIG_KEYS {
+		if CONFIG_KEYS[i].Name == name {
+			return &CONFIG_KEYS[i], nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown config key %q, see `changedir config list` for available keys", name)
+}
+
+// getConfig returns the value of a config key or an empty string if it's not
+// set.
+func getConfig(tx *bbolt.Tx, name string) string {
+	return string(tx.Bucket(BUCKET_CONFIG).Get([]byte(name)))
+}
+
+// getConfigBool returns the value of a boolean config key, false if it's not
+// set.
+func getConfigBool(tx *bbolt.Tx, name string) bool {
+	v, _ := strconv.ParseBool(getConfig(tx, name))
+	return v
+}
+
+func commandConfigList(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir config list", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir config list\n")
+		fmt.Fprintf(cmd.Output(), ww("\nList all config keys with their current values and descriptions.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	w := bufio.NewWriter(os.Stdout)
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		for _, k := range CONFIG_KEYS {
+			v := getConfig(tx, k.Name)
+			if v == "" {
+				v = "(not set)"
+			}
+			fmt.Fprintf(w, "%s = %s\n    %s\n", k.Name, v, k.Description)
+		}
+		return nil
+	}))
+	fatal(w.Flush())
+}
+
+func commandConfigGet(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir config get", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir config get <key>\n")
+		fmt.Fprintf(cmd.Output(), ww("\nPrint the value of a config key. Prints nothing if the key is not set.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if cmd.Arg(0) == "" {
+		cmd.Usage()
+		return
+	}
+	k := fatalr(findConfigKey(cmd.Arg(0)))
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		if v := getConfig(tx, k.Name); v != "" {
+			fmt.Println(v)
+		}
+		return nil
+	}))
+}
+
+func commandConfigSet(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir config set", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir config set <key> <value>\n")
+		fmt.Fprintf(cmd.Output(), ww("\nSet the value of a config key.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if cmd.NArg() != 2 {
+		cmd.Usage()
+		return
+	}
+	k := fatalr(findConfigKey(cmd.Arg(0)))
+	v := cmd.Arg(1)
+	fatal(k.Validate(v))
+	fatal(db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(BUCKET_CONFIG).Put([]byte(k.Name), []byte(v))
+	}))
+}
+
+func commandConfigUnset(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir config unset", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir config unset <key>\n")
+		fmt.Fprintf(cmd.Output(), ww("\nUnset a config key, restoring its default behavior.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if cmd.Arg(0) == "" {
+		cmd.Usage()
+		return
+	}
+	k := fatalr(findConfigKey(cmd.Arg(0)))
+	fatal(db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(BUCKET_CONFIG).Delete([]byte(k.Name))
+	}))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"sort"
+	"time"
+)
+
+type SortOrder int
+
+const (
+	SortOrder_Recent SortOrder = iota
+	SortOrder_Frecency
+)
+
+func parseSortOrder(s string) (SortOrder, error) {
+	switch s {
+	case "recent":
+		return SortOrder_Recent, nil
+	case "frecency":
+		return SortOrder_Frecency, nil
+	}
+	return 0, fmt.Errorf("Unknown sort order %q, please, use \"recent\" or \"frecency\"", s)
+}
+
+func decodeDirectoryEntry(k, v []byte) (DirectoryEntry, error) {
+	e := DirectoryEntry{Path: k}
+	path, err := expandHomeKey(string(k))
+	if err != nil {
+		return e, err
+	}
+	if path != string(k) {
+		e.Path = []byte(path)
+	}
+	if err := json.Unmarshal(v, &e); err != nil {
+		return e, fmt.Errorf("Bad history entry for %q: %s", k, err)
+	}
+	e.Project = expandHome(e.Project, homeDir())
+	return e, nil
+}
+
+func encodeDirectoryEntry(e *DirectoryEntry) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// putDirectoryEntry stores an entry under the key chosen by the
+// storage.home-relative config, the entry stored under the other key (if any)
+// is replaced.
+func putDirectoryEntry(b *bbolt.Bucket, e *DirectoryEntry) error {
+	stored := *e
+	if isHomeRelative(b.Tx()) {
+		stored.Project = contractHome(e.Project, homeDir())
+	}
+	v, err := encodeDirectoryEntry(&stored)
+	if err != nil {
+		return err
+	}
+	key := directoryKey(b.Tx(), e.Path)
+	for _, k := range directoryKeys(e.Path) {
+		if !bytes.Equal(k, key) {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	return b.Put(key, v)
+}
+
+// getDirectoryEntry looks up a directory by its absolute path.
+func getDirectoryEntry(b *bbolt.Bucket, path []byte) (e DirectoryEntry, ok bool, err error) {
+	for _, k := range directoryKeys(path) {
+		if v := b.Get(k); v != nil {
+			e, err = decodeDirectoryEntry(k, v)
+			return e, true, err
+		}
+	}
+	return DirectoryEntry{Path: path}, false, nil
+}
+
+// deleteDirectoryEntry removes a directory by its absolute path.
+func deleteDirectoryEntry(b *bbolt.Bucket, path []byte) error {
+	for _, k := range directoryKeys(path) {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getDirectoryList(db *bbolt.DB) []DirectoryEntry {
+	var out []DirectoryEntry
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(BUCKET_DIRECTORIES)
+		out = make([]DirectoryEntry, 0, b.Stats().KeyN)
+		return b.ForEach(func(k, v []byte) error {
+			e, err := decodeDirectoryEntry(append([]byte(nil), k...), v)
+			if err != nil {
+				return err
+			}
+			out = append(out, e)
+			return nil
+		})
+	}))
+	return out
+}
+
+// Frecency weights the number of visits by how long ago the last visit was,
+// the same buckets are used by z, fasd and zoxide.
+func (e *DirectoryEntry) Frecency(now time.Time) float64 {
+	age := now.Sub(e.AccessTime)
+	switch {
+	case age < time.Hour:
+		return float64(e.Visits) * 4
+	case age < 24*time.Hour:
+		return float64(e.Visits) * 2
+	case age < 7*24*time.Hour:
+		return float64(e.Visits) / 2
+	}
+	return float64(e.Visits) / 4
+}
+
+func sortDirectoryList(list []DirectoryEntry, order SortOrder, now time.Time) {
+	switch order {
+	case SortOrder_Recent:
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].AccessTime.After(list[j].AccessTime)
+		})
+	case SortOrder_Frecency:
+		sort.SliceStable(list, func(i, j int) bool {
+			a, b := list[i].Frecency(now), list[j].Frecency(now)
+			if a == b {
+				return list[i].AccessTime.After(list[j].AccessTime)
+			}
+			return a > b
+		})
+	}
+}
+
+// mergeDirectoryEntry stores an entry coming from elsewhere (e.g. an import).
+// If the directory is already in history, the newest access time and the
+// largest visit count win, tags are combined.
+func mergeDirectoryEntry(b *bbolt.Bucket, e *DirectoryEntry) error {
+	old, ok, err := getDirectoryEntry(b, e.Path)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if old.AccessTime.After(e.AccessTime) {
+			e.AccessTime = old.AccessTime
+		}
+		if old.Visits > e.Visits {
+			e.Visits = old.Visits
+		}
+		e.Tags = unionTags(old.Tags, e.Tags)
+		if e.Project == "" {
+			e.Project = old.Project
+		}
+	}
+	return putDirectoryEntry(b, e)
+}
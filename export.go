@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const EXPORT_FORMAT_VERSION = 3
+
+// Export is the JSON export format. Sections which were not exported are
+// omitted entirely, an empty section is an empty array.
+type Export struct {
+	Format      string             `json:"format"`
+	Version     int                `json:"version"`
+	Directories *[]ExportDirectory `json:"directories,omitempty"`
+	Ignores     *[]ExportIgnore    `json:"ignores,omitempty"`
+}
+
+type ExportDirectory struct {
+	Path       string    `json:"path"`
+	AccessTime time.Time `json:"atime"`
+	Visits     uint64    `json:"visits"`
+	Tags       []string  `json:"tags,omitempty"`
+}
+
+type ExportIgnore struct {
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"`
+	Allow   bool   `json:"allow,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	// version 1 had regexps only
+	RegExp string `json:"regexp,omitempty"`
+}
+
+var EXPORT_CSV_HEADER = []string{"kind", "value", "atime", "visits", "tags", "type", "allow", "comment"}
+
+const exportFormatHelp = `JSON format is a single object:
+
+  {
+    "format": "changedir",
+    "version": 3,
+    "directories": [
+      {"path": "/home/me/src", "atime": "2023-01-31T14:00:00Z", "visits": 42, "tags": ["work"]}
+    ],
+    "ignores": [
+      {"pattern": "/tmp/**", "type": "glob", "comment": "scratch files"},
+      {"pattern": "/tmp/builds/keep", "type": "prefix", "allow": true}
+    ]
+  }
+
+The "tags" field is omitted if a directory has no tags. Ignore rules are listed in order, type is "regexp", "glob" or "prefix" (see ` + "`changedir ignore put`" + `), the "allow" field is omitted for ignore rules, the "comment" field is omitted if a rule has no comment. Version 1 ignores with a "regexp" field are supported as well. Paths starting with "~" are relative to the home directory, they are expanded on import. Paths are cleaned on import, relative paths are skipped.
+
+CSV and TSV formats start with a header line "kind,value,atime,visits,tags,type,allow,comment" followed by one line per entry. Kind is either "directory" or "ignore", value is a path or a pattern respectively. Tags are separated by commas. Ignore entries only have the type, allow and comment columns, an empty type means "regexp", allow is "true" for allow rules and empty otherwise. Directories leave these columns empty. Both formats use CSV quoting rules, TSV just uses tabs instead of commas.
+`
+
+type exportSections struct {
+	directories bool
+	ignores     bool
+}
+
+func parseExportSections(s string) (exportSections, error) {
+	switch s {
+	case "":
+		return exportSections{directories: true, ignores: true}, nil
+	case "directories":
+		return exportSections{directories: true}, nil
+	case "ignores":
+		return exportSections{ignores: true}, nil
+	}
+	return exportSections{}, fmt.Errorf("Unknown section %q, please, use \"directories\" or \"ignores\"", s)
+}
+
+// exportFormat figures out file format from the --format flag value or from
+// the file name extension if the flag is empty. JSON is the default.
+func exportFormat(format string, path string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+		if format != "csv" && format != "tsv" {
+			format = "json"
+		}
+	}
+	switch format {
+	case "json", "csv", "tsv":
+		return format, nil
+	}
+	return "", fmt.Errorf("Unknown format %q, please, use \"json\", \"csv\" or \"tsv\"", format)
+}
+
+func newCSVWriter(w io.Writer, format string) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if format == "tsv" {
+		cw.Comma = '\t'
+	}
+	return cw
+}
+
+func newCSVReader(r io.Reader, format string) *csv.Reader {
+	cr := csv.NewReader(r)
+	if format == "tsv" {
+		cr.Comma = '\t'
+	}
+	return cr
+}
+
+// getExport collects the sections of the database. If homeRelative is true,
+// directories under $HOME are exported relative to it.
+func getExport(db *bbolt.DB, sections exportSections, homeRelative bool) *Export {
+	out := &Export{Format: "changedir", Version: EXPORT_FORMAT_VERSION}
+	if sections.directories {
+		list := getDirectoryList(db)
+		dirs := make([]ExportDirectory, 0, len(list))
+		home := ""
+		if homeRelative {
+			home = homeDir()
+		}
+		for _, e := range list {
+			dirs = append(dirs, ExportDirectory{
+				Path:       contractHome(string(e.Path), home),
+				AccessTime: e.AccessTime,
+				Visits:     e.Visits,
+				Tags:       e.Tags,
+			})
+		}
+		out.Directories = &dirs
+	}
+	if sections.ignores {
+		list := getValidIgnoreList(db)
+		ignores := make([]ExportIgnore, 0, len(list))
+		for _, e := range list {
+			ignores = append(ignores, ExportIgnore{Pattern: e.Pattern, Type: e.Type.String(), Allow: e.Allow, Comment: e.Comment})
+		}
+		out.Ignores = &ignores
+	}
+	return out
+}
+
+func writeExportCSV(w io.Writer, format string, export *Export) error {
+	cw := newCSVWriter(w, format)
+	if err := cw.Write(EXPORT_CSV_HEADER); err != nil {
+		return err
+	}
+	if export.Directories != nil {
+		for _, d := range *export.Directories {
+			err := cw.Write([]string{
+				"directory",
+				d.Path,
+				d.AccessTime.Format(time.RFC3339),
+				strconv.FormatUint(d.Visits, 10),
+				strings.Join(d.Tags, ","),
+				"",
+				"",
+				"",
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if export.Ignores != nil {
+		for _, i := range *export.Ignores {
+			allow := ""
+			if i.Allow {
+				allow = "true"
+			}
+			if err := cw.Write([]string{"ignore", i.Pattern, "", "", "", i.Type, allow, i.Comment}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func readExportCSV(r io.Reader, format string) (*Export, error) {
+	cr := newCSVReader(r, format)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s header: %s", format, err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"kind", "value"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("Column %q is missing in %s header", name, format)
+		}
+	}
+	column := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	dirs := []ExportDirectory{}
+	ignores := []ExportIgnore{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		switch kind := column(record, "kind"); kind {
+		case "directory":
+			d := ExportDirectory{Path: column(record, "value")}
+			if s := column(record, "atime"); s != "" {
+				if d.AccessTime, err = time.Parse(time.RFC3339, s); err != nil {
+					return nil, fmt.Errorf("Line %d: %s", line, err)
+				}
+			}
+			if s := column(record, "visits"); s != "" {
+				if d.Visits, err = strconv.ParseUint(s, 10, 64); err != nil {
+					return nil, fmt.Errorf("Line %d: %s", line, err)
+				}
+			}
+			if s := column(record, "tags"); s != "" {
+				d.Tags = strings.Split(s, ",")
+			}
+			dirs = append(dirs, d)
+		case "ignore":
+			i := ExportIgnore{Pattern: column(record, "value"), Type: column(record, "type"), Comment: column(record, "comment")}
+			if s := column(record, "allow"); s != "" {
+				if i.Allow, err = strconv.ParseBool(s); err != nil {
+					return nil, fmt.Errorf("Line %d: %s", line, err)
+				}
+			}
+			ignores = append(ignores, i)
+		default:
+			return nil, fmt.Errorf("Line %d: unknown kind %q", line, kind)
+		}
+	}
+	return &Export{
+		Format:      "changedir",
+		Version:     EXPORT_FORMAT_VERSION,
+		Directories: &dirs,
+		Ignores:     &ignores,
+	}, nil
+}
+
+func readExport(r io.Reader, format string) (*Export, error) {
+	if format != "json" {
+		return readExportCSV(r, format)
+	}
+	var export Export
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+	if export.Format != "changedir" {
+		return nil, fmt.Errorf("Not a changedir export (format is %q)", export.Format)
+	}
+	if export.Version > EXPORT_FORMAT_VERSION {
+		return nil, fmt.Errorf("Export format version is %d, but this version of changedir supports up to %d", export.Version, EXPORT_FORMAT_VERSION)
+	}
+	if export.Ignores != nil {
+		for i := range *export.Ignores {
+			if e := &(*export.Ignores)[i]; e.Pattern == "" {
+				e.Pattern = e.RegExp
+			}
+		}
+	}
+	return &export, nil
+}
+
+// importExport writes export data into the database. In replace mode all
+// existing entries of the selected sections are removed first, otherwise
+// directories are merged with existing ones (see mergeDirectoryEntry).
+func importExport(db *bbolt.DB, export *Export, sections exportSections, replace bool) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		if sections.directories && export.Directories != nil {
+			if replace {
+				if err := recreateBucket(tx, BUCKET_DIRECTORIES); err != nil {
+					return err
+				}
+			}
+			b := tx.Bucket(BUCKET_DIRECTORIES)
+			home := homeDir()
+			for _, d := range *export.Directories {
+				path := expandHome(d.Path, home)
+				if !filepath.IsAbs(path) {
+					// includes empty paths
+					continue
+				}
+				e := DirectoryEntry{
+					Path:       []byte(filepath.Clean(path)),
+					AccessTime: d.AccessTime.UTC(),
+					Visits:     d.Visits,
+					Tags:       d.Tags,
+				}
+				if err := mergeDirectoryEntry(b, &e); err != nil {
+					return err
+				}
+			}
+		}
+		if sections.ignores && export.Ignores != nil {
+			if replace {
+				if err := recreateBucket(tx, BUCKET_IGNORES); err != nil {
+					return err
+				}
+			}
+			for _, i := range *export.Ignores {
+				if i.Pattern == "" {
+					continue
+				}
+				t, err := parseIgnoreType(i.Type)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: skipping ignore rule %q: %s\n", i.Pattern, err)
+					continue
+				}
+				e := IgnoreEntry{Pattern: i.Pattern, Type: t, Allow: i.Allow, Comment: i.Comment}
+				if _, err := compileIgnoreEntry(&e); err != nil {
+					// e.g. exported by an older version without validation
+					fmt.Fprintf(os.Stderr, "Warning: skipping invalid %s %q: %s\n", e.Type, e.Pattern, err)
+					continue
+				}
+				if _, err := appendIgnoreEntry(tx, &e); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func recreateBucket(tx *bbolt.Tx, name []byte) error {
+	if err := tx.DeleteBucket(name); err != nil {
+		return err
+	}
+	_, err := tx.CreateBucket(name)
+	return err
+}
+
+func commandExport(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir export", flag.ExitOnError)
+	format := cmd.String("format", "", "output format: \"json\", \"csv\" or \"tsv\" (default is based on output file extension, otherwise json)")
+	output := cmd.String("output", "", "write to this file instead of stdout")
+	only := cmd.String("only", "", "export only one section: \"directories\" or \"ignores\"")
+	homeRelative := cmd.Bool("home-relative", false, "export directories under $HOME as \"~/...\", so that the export can be imported on another machine (default is storage.home-relative config)")
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir export [options]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nExport directories history and ignore list. The result can be loaded back using `changedir import`. Broken ignore rules (see `changedir ignore check`) are left out with a warning.\n"))
+		fmt.Fprintf(cmd.Output(), "\n%s", ww(exportFormatHelp))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	f := fatalr(exportFormat(*format, *output))
+	sections := fatalr(parseExportSections(*only))
+	if !*homeRelative {
+		fatal(db.View(func(tx *bbolt.Tx) error {
+			*homeRelative = isHomeRelative(tx)
+			return nil
+		}))
+	}
+	export := getExport(db, sections, *homeRelative)
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file := fatalr(os.Create(*output))
+		defer file.Close()
+		out = file
+	}
+	w := bufio.NewWriter(out)
+	if f == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		fatal(enc.Encode(export))
+	} else {
+		fatal(writeExportCSV(w, f, export))
+	}
+	fatal(w.Flush())
+}
+
+func commandImport(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir import", flag.ExitOnError)
+	format := cmd.String("format", "", "input format: \"json\", \"csv\" or \"tsv\" (default is based on input file extension, otherwise json)")
+	mode := cmd.String("mode", "merge", "\"merge\" with existing entries or \"replace\" them")
+	only := cmd.String("only", "", "import only one section: \"directories\" or \"ignores\"")
+	from := cmd.String("from", "changedir", "import from: \"changedir\", \"zoxide\", \"z\", \"autojump\", \"fasd\", \"fish\", \"bash\" or \"zsh\"")
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir import [options] [file]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nImport directories history and ignore list produced by `changedir export`. If file is missing or \"-\", data is read from stdin.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nWith --from, history of another directory jumper is imported instead. If file is missing, the tool's default database location is used. Scores of other tools are converted to visit counts and directories matching the ignore list or excluded by .changedirignore files are skipped. The --format option doesn't apply.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nShell history (fish, bash or zsh) is scanned for cd and pushd commands. Relative targets are resolved by replaying the history from the home directory and are kept only if they point to an existing directory.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nIn merge mode existing entries are kept, for directories present in both the newest access time and the largest visit count win, ignore rules are appended after existing ones unless the same rule is already there. In replace mode all existing entries of imported sections are removed first. Invalid ignore rules are skipped with a warning.\n"))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if *mode != "merge" && *mode != "replace" {
+		fatal(fmt.Errorf("Unknown mode %q, please, use \"merge\" or \"replace\"", *mode))
+	}
+	path := cmd.Arg(0)
+	sections := fatalr(parseExportSections(*only))
+	replace := *mode == "replace"
+
+	if *from != "changedir" {
+		imp, ok := IMPORTERS[*from]
+		if !ok {
+			fatal(fmt.Errorf("Unknown source %q, please, use \"changedir\", \"zoxide\", \"z\", \"autojump\", \"fasd\", \"fish\", \"bash\" or \"zsh\"", *from))
+		}
+		regexps := loadIgnoreList(db)
+		export := fatalr(readForeignExport(imp, path, regexps))
+		fatal(importExport(db, export, sections, replace))
+		return
+	}
+
+	f := fatalr(exportFormat(*format, path))
+
+	var in io.Reader = os.Stdin
+	if path != "" && path != "-" {
+		file := fatalr(os.Open(path))
+		defer file.Close()
+		in = file
+	}
+	export := fatalr(readExport(bufio.NewReader(in), f))
+	fatal(importExport(db, export, sections, replace))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type OutputFormat int
+
+const (
+	OutputFormat_Text OutputFormat = iota
+	OutputFormat_JSON
+	OutputFormat_JSONL
+	OutputFormat_TSV
+	OutputFormat_NUL
+)
+
+const OUTPUT_FORMAT_USAGE = "output format: \"text\", \"json\" (array), \"jsonl\" (object per line), \"tsv\" (with \\t, \\n and \\\\ escaped) or \"nul\" (NUL terminated, first column only)"
+
+func parseOutputFormat(s string) (OutputFormat, error) {
+	switch s {
+	case "text":
+		return OutputFormat_Text, nil
+	case "json":
+		return OutputFormat_JSON, nil
+	case "jsonl":
+		return OutputFormat_JSONL, nil
+	case "tsv":
+		return OutputFormat_TSV, nil
+	case "nul":
+		return OutputFormat_NUL, nil
+	}
+	return 0, fmt.Errorf("Unknown format %q, please, use \"text\", \"json\", \"jsonl\", \"tsv\" or \"nul\"", s)
+}
+
+// OutputRecord is a single record of machine-readable output. It is
+// marshaled as is for JSON formats.
+type OutputRecord interface {
+	// Columns returns values for TSV output, the first one is also used
+	// for NUL separated output.
+	Columns() []string
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// RecordWriter writes records to stdout in one of the output formats.
+type RecordWriter struct {
+	Format OutputFormat
+	w      *bufio.Writer
+	n      int
+}
+
+func newRecordWriter(format OutputFormat) *RecordWriter {
+	return &RecordWriter{Format: format, w: bufio.NewWriter(os.Stdout)}
+}
+
+// Write writes a record. In text format the record is ignored and text is
+// called to write human-readable output instead.
+func (rw *RecordWriter) Write(rec OutputRecord, text func(w *bufio.Writer)) {
+	w := rw.w
+	switch rw.Format {
+	case OutputFormat_Text:
+		text(w)
+	case OutputFormat_JSON:
+		if rw.n == 0 {
+			fatal(w.WriteByte('['))
+		} else {
+			fatal(w.WriteByte(','))
+		}
+		fatalr(w.WriteString("\n  "))
+		fatalr(w.Write(fatalr(json.Marshal(rec))))
+	case OutputFormat_JSONL:
+		fatalr(w.Write(fatalr(json.Marshal(rec))))
+		fatal(w.WriteByte('\n'))
+	case OutputFormat_TSV:
+		for i, c := range rec.Columns() {
+			if i != 0 {
+				fatal(w.WriteByte('\t'))
+			}
+			fatalr(tsvEscaper.WriteString(w, c))
+		}
+		fatal(w.WriteByte('\n'))
+	case OutputFormat_NUL:
+		fatalr(w.WriteString(rec.Columns()[0]))
+		fatal(w.WriteByte(0))
+	}
+	rw.n++
+}
+
+func (rw *RecordWriter) Close() {
+	if rw.Format == OutputFormat_JSON {
+		if rw.n == 0 {
+			fatalr(rw.w.WriteString("[]\n"))
+		} else {
+			fatalr(rw.w.WriteString("\n]\n"))
+		}
+	}
+	fatal(rw.w.Flush())
+}
+
+type DirectoryRecord struct {
+	Path       string    `json:"path"`
+	AccessTime time.Time `json:"atime"`
+	Visits     uint64    `json:"visits"`
+	Tags       []string  `json:"tags,omitempty"`
+	Project    string    `json:"project,omitempty"`
+}
+
+func newDirectoryRecord(e *DirectoryEntry) *DirectoryRecord {
+	return &DirectoryRecord{
+		Path:       string(e.Path),
+		AccessTime: e.AccessTime,
+		Visits:     e.Visits,
+		Tags:       e.Tags,
+		Project:    e.Project,
+	}
+}
+
+func (r *DirectoryRecord) Columns() []string {
+	return []string{
+		r.Path,
+		r.AccessTime.Format(time.RFC3339),
+		fmt.Sprint(r.Visits),
+		strings.Join(r.Tags, ","),
+		r.Project,
+	}
+}
+
+type IgnoreRecord struct {
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"`
+	Allow   bool   `json:"allow"`
+	Index   int    `json:"index"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func (r *IgnoreRecord) Columns() []string {
+	return []string{r.Pattern, r.Type, strconv.FormatBool(r.Allow), strconv.Itoa(r.Index), r.Comment}
+}
+
+func (r *IgnoreRecord) Action() string {
+	if r.Allow {
+		return "allow"
+	}
+	return "ignore"
+}
+
+type RemovedRecord struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+func (r *RemovedRecord) Columns() []string {
+	return []string{r.Path, r.Reason}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directories under $HOME may be stored relative to it (see
+// storage.home-relative config), such keys start with "~". In memory paths are
+// always absolute, keys are converted by decodeDirectoryEntry and
+// putDirectoryEntry.
+
+// homeDir returns the clean home directory or an empty string if it's unknown.
+func homeDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil || !filepath.IsAbs(home) {
+		return ""
+	}
+	home = filepath.Clean(home)
+	if home == "/" {
+		return ""
+	}
+	return home
+}
+
+// contractHome replaces the home directory at the start of path with "~".
+func contractHome(path, home string) string {
+	if home == "" || !isUnder(path, home) {
+		return path
+	}
+	return "~" + path[len(home):]
+}
+
+// expandHome is the reverse of contractHome.
+func expandHome(path, home string) string {
+	if home == "" || (path != "~" && !strings.HasPrefix(path, "~/")) {
+		return path
+	}
+	return home + path[1:]
+}
+
+// expandHomeKey expands a directory key. Home-relative keys can't be expanded
+// if the home directory is unknown (e.g. $HOME is not set in cron), that's an
+// error rather than a relative path, otherwise prune would remove them as
+// missing.
+func expandHomeKey(key string) (string, error) {
+	if key != "~" && !strings.HasPrefix(key, "~/") {
+		return key, nil
+	}
+	home := homeDir()
+	if home == "" {
+		return "", fmt.Errorf("Home directory is unknown, can't expand %q, please, set $HOME", key)
+	}
+	return expandHome(key, home), nil
+}
+
+func isHomeRelative(tx *bbolt.Tx) bool {
+	return getConfigBool(tx, "storage.home-relative")
+}
+
+// directoryKey returns the key a directory should be stored under.
+func directoryKey(tx *bbolt.Tx, path []byte) []byte {
+	if isHomeRelative(tx) {
+		return []byte(contractHome(string(path), homeDir()))
+	}
+	return path
+}
+
+// directoryKeys returns all keys a directory may be stored under: absolute
+// and relative to $HOME. The config may have changed since the directory was
+// stored.
+func directoryKeys(path []byte) [][]byte {
+	out := [][]byte{path}
+	if k := contractHome(string(path), homeDir()); k != string(path) {
+		out = append(out, []byte(k))
+	}
+	return out
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"go.etcd.io/bbolt"
+	"reflect"
+	"testing"
+)
+
+func TestContractExpandHome(t *testing.T) {
+	tests := []struct {
+		path     string
+		home     string
+		relative string
+	}{
+		{"/home/me", "/home/me", "~"},
+		{"/home/me/src", "/home/me", "~/src"},
+		{"/home/meow", "/home/me", "/home/meow"},
+		{"/tmp", "/home/me", "/tmp"},
+		{"/home/me/src", "", "/home/me/src"},
+	}
+	for _, tt := range tests {
+		if got := contractHome(tt.path, tt.home); got != tt.relative {
+			t.Errorf("contractHome(%q, %q) = %q, want %q", tt.path, tt.home, got, tt.relative)
+		}
+		if tt.home == "" {
+			continue
+		}
+		if got := expandHome(tt.relative, tt.home); got != tt.path {
+			t.Errorf("expandHome(%q, %q) = %q, want %q", tt.relative, tt.home, got, tt.path)
+		}
+	}
+}
+
+func TestExpandHomeKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		home    string
+		want    string
+		wantErr bool
+	}{
+		{"/tmp", "/home/me", "/tmp", false},
+		{"~", "/home/me", "/home/me", false},
+		{"~/src", "/home/me", "/home/me/src", false},
+		{"~src", "/home/me", "~src", false},
+		{"/tmp", "", "/tmp", false},
+		{"~/src", "", "", true},
+		{"~", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("HOME", tt.home)
+		got, err := expandHomeKey(tt.key)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("expandHomeKey(%q) with HOME=%q = %q, %v, want %q, error: %v", tt.key, tt.home, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDirectoryKeys(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/tmp", []string{"/tmp"}},
+		{"/home/me", []string{"/home/me", "~"}},
+		{"/home/me/src", []string{"/home/me/src", "~/src"}},
+		{"/home/meow", []string{"/home/meow"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, k := range directoryKeys([]byte(tt.path)) {
+			got = append(got, string(k))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("directoryKeys(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestHomeRelativeStorage puts and looks up entries while switching
+// storage.home-relative config, the key must follow the config and there must
+// be a single entry per directory.
+func TestHomeRelativeStorage(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	db, _ := openTestDB(t, createTestBuckets)
+	tests := []struct {
+		homeRelative string
+		path         string
+		visits       uint64
+		keys         []string
+	}{
+		{"true", "/home/me/src", 1, []string{"~/src"}},
+		{"false", "/home/me/src", 2, []string{"/home/me/src"}},
+		{"true", "/tmp", 1, []string{"/home/me/src", "/tmp"}},
+		{"true", "/home/me/src", 3, []string{"/tmp", "~/src"}},
+	}
+	for i, tt := range tests {
+		err := db.Update(func(tx *bbolt.Tx) error {
+			if err := tx.Bucket(BUCKET_CONFIG).Put([]byte("storage.home-relative"), []byte(tt.homeRelative)); err != nil {
+				return err
+			}
+			b := tx.Bucket(BUCKET_DIRECTORIES)
+			e, _, err := getDirectoryEntry(b, []byte(tt.path))
+			if err != nil {
+				return err
+			}
+			e.Visits++
+			if e.Visits != tt.visits {
+				t.Errorf("step %d: %s has %d visits, want %d", i, tt.path, e.Visits, tt.visits)
+			}
+			if err := putDirectoryEntry(b, &e); err != nil {
+				return err
+			}
+			var keys []string
+			err = b.ForEach(func(k, v []byte) error {
+				keys = append(keys, string(k))
+				return nil
+			})
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("step %d: keys are %q, want %q", i, keys, tt.keys)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDirectoryListUnderHomeRelative(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	db, _ := openTestDB(t, func(tx *bbolt.Tx) error {
+		if err := createTestBuckets(tx); err != nil {
+			return err
+		}
+		b := tx.Bucket(BUCKET_DIRECTORIES)
+		for _, k := range []string{"/home/meow", "/tmp/a", "~", "~/src", "~/src/a"} {
+			if err := b.Put([]byte(k), []byte(`{"visits":1}`)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	tests := []struct {
+		dir  string
+		want []string
+	}{
+		{"/", []string{"/home/meow", "/tmp/a", "/home/me", "/home/me/src", "/home/me/src/a"}},
+		{"/home", []string{"/home/meow", "/home/me", "/home/me/src", "/home/me/src/a"}},
+		{"/home/me", []string{"/home/me", "/home/me/src", "/home/me/src/a"}},
+		{"/home/me/src", []string{"/home/me/src", "/home/me/src/a"}},
+		{"/tmp", []string{"/tmp/a"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, e := range getDirectoryListUnder(db, tt.dir) {
+			got = append(got, string(e.Path))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("getDirectoryListUnder(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,631 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type IgnoreType int
+
+const (
+	IgnoreType_RegExp IgnoreType = iota
+	IgnoreType_Glob
+	IgnoreType_Prefix
+)
+
+func parseIgnoreType(s string) (IgnoreType, error) {
+	switch s {
+	case "regexp", "":
+		return IgnoreType_RegExp, nil
+	case "glob":
+		return IgnoreType_Glob, nil
+	case "prefix":
+		return IgnoreType_Prefix, nil
+	}
+	return 0, fmt.Errorf("Unknown ignore type %q, please, use \"regexp\", \"glob\" or \"prefix\"", s)
+}
+
+func (t IgnoreType) String() string {
+	switch t {
+	case IgnoreType_Glob:
+		return "glob"
+	case IgnoreType_Prefix:
+		return "prefix"
+	}
+	return "regexp"
+}
+
+func (t IgnoreType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *IgnoreType) UnmarshalText(text []byte) (err error) {
+	*t, err = parseIgnoreType(string(text))
+	return err
+}
+
+// IgnoreEntry is a rule of the ignore list. Rules are checked in order and the
+// last matching one wins: a directory is ignored if it's an ignore rule and
+// stored if it's an allow rule. Keys are the order of the rules (see itob),
+// since bbolt sorts keys. Comment explains why the rule is there, it may
+// contain several lines.
+type IgnoreEntry struct {
+	Key     uint64     `json:"-"`
+	Pattern string     `json:"pattern"`
+	Type    IgnoreType `json:"type"`
+	Allow   bool       `json:"allow,omitempty"`
+	Comment string     `json:"comment,omitempty"`
+}
+
+// Action returns "allow" or "ignore".
+func (e *IgnoreEntry) Action() string {
+	if e.Allow {
+		return "allow"
+	}
+	return "ignore"
+}
+
+// SameRule reports whether two entries are the same rule, regardless of their
+// order and comments.
+func (e *IgnoreEntry) SameRule(other *IgnoreEntry) bool {
+	return e.Pattern == other.Pattern && e.Type == other.Type && e.Allow == other.Allow
+}
+
+type IgnoreEntryCompiled struct {
+	Entry  IgnoreEntry
+	RegExp *regexp.Regexp
+}
+
+// BrokenIgnoreEntry is an entry which can't be compiled, e.g. stored by an
+// older version without validation.
+type BrokenIgnoreEntry struct {
+	Entry IgnoreEntry
+	Err   error
+}
+
+// Broken ignore entries are reported by commands using the ignore list, but
+// not more often than once per IGNORE_WARNING_INTERVAL, so that put in the
+// shell prompt hook doesn't print it every time.
+const IGNORE_WARNING_INTERVAL = 24 * time.Hour
+
+var META_IGNORE_WARNING_LAST_RUN = []byte("ignore_warning_last_run")
+
+func decodeIgnoreEntry(k, v []byte) (IgnoreEntry, error) {
+	var e IgnoreEntry
+	if len(k) != 8 {
+		return e, fmt.Errorf("Bad ignore entry key: %x", k)
+	}
+	if err := json.Unmarshal(v, &e); err != nil {
+		return e, fmt.Errorf("Bad ignore entry %d: %s", btoi(k), err)
+	}
+	e.Key = btoi(k)
+	return e, nil
+}
+
+func putIgnoreEntry(b *bbolt.Bucket, e *IgnoreEntry) error {
+	v, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.Put(itob(e.Key), v)
+}
+
+func getIgnoreEntries(tx *bbolt.Tx) ([]IgnoreEntry, error) {
+	b := tx.Bucket(BUCKET_IGNORES)
+	out := make([]IgnoreEntry, 0, b.Stats().KeyN)
+	err := b.ForEach(func(k, v []byte) error {
+		e, err := decodeIgnoreEntry(k, v)
+		if err != nil {
+			return err
+		}
+		out = append(out, e)
+		return nil
+	})
+	return out, err
+}
+
+// getIgnoreList returns all rules in order.
+func getIgnoreList(db *bbolt.DB) []IgnoreEntry {
+	var out []IgnoreEntry
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		var err error
+		out, err = getIgnoreEntries(tx)
+		return err
+	}))
+	return out
+}
+
+// appendIgnoreEntry adds a rule to the end of the list, unless the same rule
+// is already there. Returns false in the latter case, the comment of the
+// existing rule is replaced if the new one has a comment.
+func appendIgnoreEntry(tx *bbolt.Tx, e *IgnoreEntry) (bool, error) {
+	list, err := getIgnoreEntries(tx)
+	if err != nil {
+		return false, err
+	}
+	for i := range list {
+		if list[i].SameRule(e) {
+			if e.Comment == "" || e.Comment == list[i].Comment {
+				return false, nil
+			}
+			list[i].Comment = e.Comment
+			return false, putIgnoreEntry(tx.Bucket(BUCKET_IGNORES), &list[i])
+		}
+	}
+	e.Key = 1
+	if len(list) > 0 {
+		e.Key = list[len(list)-1].Key + 1
+	}
+	return true, putIgnoreEntry(tx.Bucket(BUCKET_IGNORES), e)
+}
+
+// replaceIgnoreList stores the list in the given order, keys are renumbered.
+func replaceIgnoreList(tx *bbolt.Tx, list []IgnoreEntry) error {
+	if err := recreateBucket(tx, BUCKET_IGNORES); err != nil {
+		return err
+	}
+	b := tx.Bucket(BUCKET_IGNORES)
+	for i := range list {
+		list[i].Key = uint64(i + 1)
+		if err := putIgnoreEntry(b, &list[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// globToRegexp converts a glob pattern to a regexp:
+//
+//   - "*" matches anything except "/", "?" matches a single character except
+//     "/", "[...]" matches a character class ("[!...]" negates it);
+//   - "**" matches anything including "/", "/**/" matches zero or more
+//     directories, a trailing "/**" matches the directory itself too;
+//   - "\" escapes the next character;
+//   - a leading "~" is the home directory;
+//   - a glob without "/" matches any path component, e.g. "node_modules"
+//     matches all node_modules directories and their subdirectories, other
+//     globs must match the whole path.
+func globToRegexp(glob string) (string, error) {
+	glob = expandHome(glob, homeDir())
+	if !strings.Contains(glob, "/") {
+		re, err := globPartToRegexp(glob)
+		if err != nil {
+			return "", err
+		}
+		return "(^|/)" + re + "(/|$)", nil
+	}
+	if !strings.HasPrefix(glob, "/") && !strings.HasPrefix(glob, "**/") {
+		return "", fmt.Errorf("Glob %q must start with \"/\", \"~/\" or \"**/\", or contain no slashes", glob)
+	}
+	suffix := "$"
+	if strings.HasSuffix(glob, "/**") {
+		glob = strings.TrimSuffix(glob, "/**")
+		suffix = "(/.*)?$"
+	}
+	re, err := globPartToRegexp(glob)
+	if err != nil {
+		return "", err
+	}
+	return "^" + re + suffix, nil
+}
+
+func globPartToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if (i == 1 || glob[i-2] == '/') && i+1 < len(glob) && glob[i+1] == '/' {
+					// "**/" as a whole component: zero or more directories
+					i++
+					b.WriteString("(.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == 0 {
+				// "]" right after "[" is a part of the class
+				if next := strings.IndexByte(glob[i+2:], ']'); next != -1 {
+					end = next + 1
+				} else {
+					end = -1
+				}
+			}
+			if end == -1 {
+				return "", fmt.Errorf("Unterminated character class in glob %q", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			b.WriteByte('[')
+			if strings.HasPrefix(class, "!") || strings.HasPrefix(class, "^") {
+				b.WriteByte('^')
+				class = class[1:]
+			}
+			b.WriteString(strings.ReplaceAll(class, `\`, `\\`))
+			b.WriteByte(']')
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String(), nil
+}
+
+// prefixToRegexp matches the directory and all its subdirectories, a leading
+// "~" is the home directory.
+func prefixToRegexp(prefix string) string {
+	prefix = filepath.Clean(expandHome(prefix, homeDir()))
+	return "^" + regexp.QuoteMeta(strings.TrimSuffix(prefix, "/")) + "(/|$)"
+}
+
+// compileIgnoreEntry returns the regexp an entry is checked with.
+func compileIgnoreEntry(e *IgnoreEntry) (*regexp.Regexp, error) {
+	re := string(e.Pattern)
+	switch e.Type {
+	case IgnoreType_Glob:
+		var err error
+		if re, err = globToRegexp(re); err != nil {
+			return nil, err
+		}
+	case IgnoreType_Prefix:
+		re = prefixToRegexp(re)
+	}
+	return regexp.Compile(re)
+}
+
+// compileIgnoreList compiles all entries, broken entries are returned
+// separately.
+func compileIgnoreList(list []IgnoreEntry) ([]IgnoreEntryCompiled, []BrokenIgnoreEntry) {
+	out := make([]IgnoreEntryCompiled, 0, len(list))
+	var broken []BrokenIgnoreEntry
+	for _, v := range list {
+		r, err := compileIgnoreEntry(&v)
+		if err != nil {
+			broken = append(broken, BrokenIgnoreEntry{Entry: v, Err: err})
+			continue
+		}
+		out = append(out, IgnoreEntryCompiled{Entry: v, RegExp: r})
+	}
+	return out, broken
+}
+
+// loadIgnoreList returns compiled ignore list, broken entries are skipped with
+// a warning (see IGNORE_WARNING_INTERVAL).
+func loadIgnoreList(db *bbolt.DB) []IgnoreEntryCompiled {
+	out, broken := compileIgnoreList(getIgnoreList(db))
+	if len(broken) > 0 {
+		warnBrokenIgnores(db, len(broken))
+	}
+	return out
+}
+
+// getValidIgnoreList returns rules which can be compiled, for writing them
+// somewhere they will be validated when read back (export, ignore save).
+// Broken rules are left out with a warning.
+func getValidIgnoreList(db *bbolt.DB) []IgnoreEntry {
+	compiled, broken := compileIgnoreList(getIgnoreList(db))
+	if len(broken) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d broken ignore rule(s) are left out, see `changedir ignore check`\n", len(broken))
+	}
+	out := make([]IgnoreEntry, 0, len(compiled))
+	for _, c := range compiled {
+		out = append(out, c.Entry)
+	}
+	return out
+}
+
+func warnBrokenIgnores(db *bbolt.DB, n int) {
+	now := time.Now()
+	warn := false
+	fatal(db.Update(func(tx *bbolt.Tx) error {
+		meta := tx.Bucket(BUCKET_META)
+		if v := meta.Get(META_IGNORE_WARNING_LAST_RUN); len(v) == 8 {
+			if now.Sub(time.Unix(int64(btoi(v)), 0)) < IGNORE_WARNING_INTERVAL {
+				return nil
+			}
+		}
+		warn = true
+		return meta.Put(META_IGNORE_WARNING_LAST_RUN, itob(uint64(now.Unix())))
+	}))
+	if warn {
+		fmt.Fprintf(os.Stderr, "Warning: ignore list contains %d broken pattern(s) which are skipped, see `changedir ignore check`\n", n)
+	}
+}
+
+// isIgnored checks the directory against all rules, the last matching rule
+// wins.
+func isIgnored(regexps []IgnoreEntryCompiled, dir []byte) bool {
+	for i := len(regexps) - 1; i >= 0; i-- {
+		if regexps[i].RegExp.Match(dir) {
+			return !regexps[i].Entry.Allow
+		}
+	}
+	return false
+}
+
+// matchingIgnores returns all rules matching the directory in order, i.e. the
+// last one decides.
+func matchingIgnores(regexps []IgnoreEntryCompiled, dir []byte) []IgnoreEntry {
+	var out []IgnoreEntry
+	for _, r := range regexps {
+		if r.RegExp.Match(dir) {
+			out = append(out, r.Entry)
+		}
+	}
+	return out
+}
+
+// ignoreIndexes maps rule keys to their positions in the list as shown by
+// ignore list, starting from 1.
+func ignoreIndexes(list []IgnoreEntry) map[uint64]int {
+	out := make(map[uint64]int, len(list))
+	for i := range list {
+		out[list[i].Key] = i + 1
+	}
+	return out
+}
+
+func newIgnoreRecord(e *IgnoreEntry, index int) *IgnoreRecord {
+	return &IgnoreRecord{Index: index, Pattern: e.Pattern, Type: e.Type.String(), Allow: e.Allow, Comment: e.Comment}
+}
+
+// formatIgnoreComment returns the comment on a single line for text output,
+// with a separator in front of it.
+func formatIgnoreComment(comment string) string {
+	if comment == "" {
+		return ""
+	}
+	return "  # " + strings.Join(strings.Split(comment, "\n"), " ")
+}
+
+type IgnoreTestRecord struct {
+	Path      string         `json:"path"`
+	Matches   []IgnoreRecord `json:"matches"`
+	Marker    string         `json:"marker,omitempty"`
+	Stored    bool           `json:"stored"`
+	InHistory bool           `json:"in_history"`
+}
+
+func (r *IgnoreTestRecord) Columns() []string {
+	return []string{r.Path, strconv.FormatBool(r.Stored), strconv.FormatBool(r.InHistory), r.Marker}
+}
+
+func commandIgnoreTest(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir ignore test", flag.ExitOnError)
+	format := cmd.String("format", "text", OUTPUT_FORMAT_USAGE)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore test [options] [directory]...\n")
+		fmt.Fprintf(cmd.Output(), ww("\nExplain how ignore list applies to directories. If no directories are given, they are read from stdin, one per line. Directories are brought to the form put uses first (see `changedir put`). For every directory the command prints rules matching it in order (the last one decides), whether put would store it and whether it's in history now. If a .changedirignore file excludes the directory (see `changedir ignore apply`), the path of the file is printed too.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nTSV columns are: directory, whether put would store it and whether it's in history (\"true\" or \"false\") and the path of the .changedirignore file excluding it (empty if none). JSON objects contain the same fields: \"path\", \"stored\", \"in_history\" and \"marker\" (omitted if empty), plus \"matches\" with matching rules (see `changedir ignore list`).\n"))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	dirs := cmd.Args()
+	if len(dirs) == 0 {
+		s := bufio.NewScanner(os.Stdin)
+		for s.Scan() {
+			if line := strings.TrimSpace(s.Text()); line != "" {
+				dirs = append(dirs, line)
+			}
+		}
+		fatal(s.Err())
+	}
+
+	rw := newRecordWriter(fatalr(parseOutputFormat(*format)))
+	regexps := loadIgnoreList(db)
+	indexes := ignoreIndexes(getIgnoreList(db))
+	resolve := getResolveSymlinks(db)
+	markers := newIgnoreMarkers()
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(BUCKET_DIRECTORIES)
+		for _, d := range dirs {
+			dir, err := canonicalPath(d, resolve)
+			if err != nil {
+				return err
+			}
+			_, inHistory, err := getDirectoryEntry(b, []byte(dir))
+			if err != nil {
+				return err
+			}
+			rec := &IgnoreTestRecord{Path: dir, Matches: []IgnoreRecord{}, Marker: markers.Find(dir), InHistory: inHistory}
+			for _, e := range matchingIgnores(regexps, []byte(dir)) {
+				rec.Matches = append(rec.Matches, *newIgnoreRecord(&e, indexes[e.Key]))
+			}
+			rec.Stored = !isIgnored(regexps, []byte(dir)) && rec.Marker == ""
+			rw.Write(rec, func(w *bufio.Writer) {
+				fmt.Fprintf(w, "%s\n", rec.Path)
+				for _, m := range rec.Matches {
+					fmt.Fprintf(w, "    matches %3d %-6s %-7s '%s'%s\n", m.Index, m.Action(), m.Type, m.Pattern, formatIgnoreComment(m.Comment))
+				}
+				if rec.Marker != "" {
+					fmt.Fprintf(w, "    excluded by %s\n", rec.Marker)
+				}
+				if rec.Stored {
+					fmt.Fprintf(w, "    put would store it\n")
+				} else {
+					fmt.Fprintf(w, "    put would ignore it\n")
+				}
+				if rec.InHistory {
+					fmt.Fprintf(w, "    in history\n")
+				} else {
+					fmt.Fprintf(w, "    not in history\n")
+				}
+			})
+		}
+		return nil
+	}))
+	rw.Close()
+}
+
+func commandIgnoreList(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir ignore list", flag.ExitOnError)
+	format := cmd.String("format", "text", OUTPUT_FORMAT_USAGE)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore list [options]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nList all rules from ignore list in order. Each line contains the position of the rule, whether it ignores or allows matching directories, pattern type, the pattern and the comment after \"#\" if there is one. All patterns are enclosed in '' quotes, this is to help you see spaces in patterns, which are allowed. Other formats contain patterns as is, TSV columns are: pattern, type, \"true\" for allow rules or \"false\" otherwise, the position and the comment. JSON objects contain the same fields: \"pattern\", \"type\", \"allow\", \"index\" and \"comment\" (omitted if empty).\n"))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	rw := newRecordWriter(fatalr(parseOutputFormat(*format)))
+	list := getIgnoreList(db)
+	for i, e := range list {
+		rec := newIgnoreRecord(&e, i+1)
+		rw.Write(rec, func(w *bufio.Writer) {
+			fmt.Fprintf(w, "%3d %-6s %-7s '%s'%s\n", rec.Index, rec.Action(), rec.Type, rec.Pattern, formatIgnoreComment(rec.Comment))
+		})
+	}
+	rw.Close()
+}
+
+func commandIgnorePut(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir ignore put", flag.ExitOnError)
+	glob := cmd.Bool("glob", false, "the pattern is a glob")
+	prefix := cmd.Bool("prefix", false, "the pattern is a directory, it matches all its subdirectories too")
+	allow := cmd.Bool("allow", false, "add an allow rule: matching directories are stored even if earlier rules ignore them")
+	comment := cmd.String("comment", "", "explain why the rule is there, replaces the comment if the rule exists already")
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore put [options] <pattern>\n")
+		fmt.Fprintf(cmd.Output(), ww("\nAdd a rule to the end of the list, unless the same rule is already there. Matching directories will not be stored. Rules are checked in order and the last matching one wins, so an allow rule can make an exception for some directories ignored by earlier rules, e.g. ignore \"/tmp/**\" and then allow \"/tmp/builds/keep\". Use `changedir ignore move` to reorder rules.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nBy default the pattern is a Go regexp (https://pkg.go.dev/regexp/syntax), it matches a directory if it matches any part of its path, use ^ and $ to match the whole path.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nGlobs support * (anything except /), ? (a single character except /), [...] character classes ([!...] to negate) and ** (anything including /). For example, \"/tmp/**\" matches /tmp and all its subdirectories, \"~/src/**/build\" matches all build directories under ~/src. A glob without slashes matches any path component, e.g. \"node_modules\" matches all node_modules directories with their subdirectories, other globs must match the whole path and start with \"/\", \"~/\" or \"**/\".\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nPrefix is a directory which matches with all its subdirectories, e.g. \"~/.cache\". No characters have special meaning in prefixes except ~ at the start.\n"))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	pattern := cmd.Arg(0)
+	if pattern == "" {
+		cmd.Usage()
+		return
+	}
+
+	e := IgnoreEntry{Pattern: pattern, Allow: *allow, Comment: strings.TrimSpace(*comment)}
+	switch {
+	case *glob && *prefix:
+		fatal(fmt.Errorf("Options --glob and --prefix can't be used together"))
+	case *glob:
+		e.Type = IgnoreType_Glob
+	case *prefix:
+		e.Type = IgnoreType_Prefix
+	}
+	if _, err := compileIgnoreEntry(&e); err != nil {
+		fatal(fmt.Errorf("Invalid %s %q: %s", e.Type, pattern, err))
+	}
+	fatal(db.Update(func(tx *bbolt.Tx) error {
+		_, err := appendIgnoreEntry(tx, &e)
+		return err
+	}))
+}
+
+func commandIgnoreCheck(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir ignore check", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore check\n")
+		fmt.Fprintf(cmd.Output(), ww("\nList broken rules from ignore list with the errors, one per line (tab separated). Rules are shown the same way as by `changedir ignore list`. Broken patterns never match anything, they may be left by older versions which didn't validate patterns. Exits with status 1 if there are broken patterns.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	list := getIgnoreList(db)
+	indexes := ignoreIndexes(list)
+	_, broken := compileIgnoreList(list)
+	w := bufio.NewWriter(os.Stdout)
+	for _, b := range broken {
+		e := &b.Entry
+		fmt.Fprintf(w, "%3d %-6s %-7s '%s'\t%s\n", indexes[e.Key], e.Action(), e.Type, e.Pattern, b.Err)
+	}
+	fatal(w.Flush())
+	if len(broken) > 0 {
+		os.Exit(1)
+	}
+}
+
+func commandIgnoreRemove(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir ignore remove", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore remove <pattern>\n")
+		fmt.Fprintf(cmd.Output(), ww("\nRemove all rules with the pattern from the list.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	pattern := cmd.Arg(0)
+	if pattern == "" {
+		// do nothing
+		return
+	}
+
+	fatal(db.Update(func(tx *bbolt.Tx) error {
+		list, err := getIgnoreEntries(tx)
+		if err != nil {
+			return err
+		}
+		b := tx.Bucket(BUCKET_IGNORES)
+		for _, e := range list {
+			if e.Pattern == pattern {
+				if err := b.Delete(itob(e.Key)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}))
+}
+
+func commandIgnoreMove(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir ignore move", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore move <from> <to>\n")
+		fmt.Fprintf(cmd.Output(), ww("\nMove a rule to another position in the list, positions are the ones shown by `changedir ignore list`. Rules in between are shifted. Since the last matching rule wins, move allow rules after the ignore rules they make exceptions for.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if cmd.NArg() != 2 {
+		cmd.Usage()
+		return
+	}
+	from := fatalr(strconv.Atoi(cmd.Arg(0)))
+	to := fatalr(strconv.Atoi(cmd.Arg(1)))
+	fatal(db.Update(func(tx *bbolt.Tx) error {
+		list, err := getIgnoreEntries(tx)
+		if err != nil {
+			return err
+		}
+		for _, pos := range []int{from, to} {
+			if pos < 1 || pos > len(list) {
+				return fmt.Errorf("Position %d is out of range, there are %d rules", pos, len(list))
+			}
+		}
+		e := list[from-1]
+		list = append(list[:from-1], list[from:]...)
+		list = append(list[:to-1], append([]IgnoreEntry{e}, list[to-1:]...)...)
+		return replaceIgnoreList(tx, list)
+	}))
+}
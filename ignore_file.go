@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"io"
+	"os"
+	"strings"
+)
+
+const ignoreFileHelp = `Ignore file format is similar to .gitignore, one rule per line:
+
+  # scratch files
+  /tmp/**
+
+  # but keep builds, they take ages
+  !prefix:/tmp/builds/keep
+  regexp:^/mnt/[^/]+$
+
+Rules are globs unless they start with a type: "glob:", "prefix:" or "regexp:" (see ` + "`changedir ignore put`" + `). Rules starting with "!" are allow rules. Lines starting with "#" are comments, comment lines right before a rule become the comment of the rule, a blank line between a comment and a rule separates them. Trailing spaces are removed.
+`
+
+// parseIgnoreLine parses a rule line of an ignore file, see ignoreFileHelp. The
+// pattern is not validated.
+func parseIgnoreLine(line string) (IgnoreEntry, error) {
+	e := IgnoreEntry{Type: IgnoreType_Glob}
+	if strings.HasPrefix(line, "!") {
+		e.Allow = true
+		line = line[1:]
+	}
+	if i := strings.IndexByte(line, ':'); i > 0 {
+		if t, err := parseIgnoreType(line[:i]); err == nil {
+			e.Type = t
+			line = line[i+1:]
+		}
+	}
+	if line == "" {
+		return e, fmt.Errorf("Empty pattern")
+	}
+	e.Pattern = line
+	return e, nil
+}
+
+// formatIgnoreLine is the reverse of parseIgnoreLine. Globs get an explicit
+// type if they would be read as something else otherwise.
+func formatIgnoreLine(e *IgnoreEntry) string {
+	var b strings.Builder
+	if e.Allow {
+		b.WriteByte('!')
+	}
+	p := e.Pattern
+	explicit := e.Type != IgnoreType_Glob || strings.HasPrefix(p, "!") || strings.HasPrefix(p, "#")
+	if i := strings.IndexByte(p, ':'); i > 0 {
+		if _, err := parseIgnoreType(p[:i]); err == nil {
+			explicit = true
+		}
+	}
+	if explicit {
+		b.WriteString(e.Type.String())
+		b.WriteByte(':')
+	}
+	b.WriteString(p)
+	return b.String()
+}
+
+func readIgnoreFile(r io.Reader) ([]IgnoreEntry, error) {
+	var out []IgnoreEntry
+	var comment []string
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		switch {
+		case line == "":
+			comment = nil
+		case strings.HasPrefix(line, "#"):
+			comment = append(comment, strings.TrimSpace(line[1:]))
+		default:
+			e, err := parseIgnoreLine(line)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: %s", n, err)
+			}
+			if _, err := compileIgnoreEntry(&e); err != nil {
+				return nil, fmt.Errorf("Line %d: invalid %s %q: %s", n, e.Type, e.Pattern, err)
+			}
+			e.Comment = strings.TrimSpace(strings.Join(comment, "\n"))
+			comment = nil
+			out = append(out, e)
+		}
+	}
+	return out, s.Err()
+}
+
+func writeIgnoreFile(w io.Writer, list []IgnoreEntry) error {
+	bw := bufio.NewWriter(w)
+	for i := range list {
+		e := &list[i]
+		if e.Comment != "" {
+			if i != 0 {
+				fmt.Fprintf(bw, "\n")
+			}
+			for _, line := range strings.Split(e.Comment, "\n") {
+				fmt.Fprintf(bw, "# %s\n", line)
+			}
+		}
+		fmt.Fprintf(bw, "%s\n", formatIgnoreLine(e))
+	}
+	return bw.Flush()
+}
+
+func commandIgnoreLoad(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir ignore load", flag.ExitOnError)
+	mode := cmd.String("mode", "merge", "\"merge\" with existing rules or \"replace\" them")
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore load [options] [file]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nLoad ignore rules from a text file, e.g. one shared by a team. If file is missing or \"-\", rules are read from stdin. Nothing is loaded if any of the rules is invalid.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nIn merge mode rules are appended after existing ones unless the same rule is already there, comments from the file replace comments of existing rules. In replace mode the ignore list becomes exactly the file.\n"))
+		fmt.Fprintf(cmd.Output(), "\n%s", ww(ignoreFileHelp))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if *mode != "merge" && *mode != "replace" {
+		fatal(fmt.Errorf("Unknown mode %q, please, use \"merge\" or \"replace\"", *mode))
+	}
+	var in io.Reader = os.Stdin
+	if path := cmd.Arg(0); path != "" && path != "-" {
+		file := fatalr(os.Open(path))
+		defer file.Close()
+		in = file
+	}
+	list := fatalr(readIgnoreFile(in))
+	fatal(db.Update(func(tx *bbolt.Tx) error {
+		if *mode == "replace" {
+			return replaceIgnoreList(tx, list)
+		}
+		for i := range list {
+			if _, err := appendIgnoreEntry(tx, &list[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func commandIgnoreSave(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir ignore save", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore save [file]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nSave ignore rules with their comments to a text file, which can be loaded back using `changedir ignore load`. If file is missing or \"-\", rules are written to stdout. Broken rules (see `changedir ignore check`) are left out with a warning.\n"))
+		fmt.Fprintf(cmd.Output(), "\n%s", ww(ignoreFileHelp))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	list := getValidIgnoreList(db)
+	var out io.Writer = os.Stdout
+	if path := cmd.Arg(0); path != "" && path != "-" {
+		file := fatalr(os.Create(path))
+		defer file.Close()
+		out = file
+	}
+	fatal(writeIgnoreFile(out, list))
+}
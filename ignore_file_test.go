@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseIgnoreLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want IgnoreEntry
+	}{
+		{"/tmp/**", IgnoreEntry{Pattern: "/tmp/**", Type: IgnoreType_Glob}},
+		{"!/tmp/keep", IgnoreEntry{Pattern: "/tmp/keep", Type: IgnoreType_Glob, Allow: true}},
+		{"prefix:~/.cache", IgnoreEntry{Pattern: "~/.cache", Type: IgnoreType_Prefix}},
+		{"!regexp:^/mnt/[^/]+$", IgnoreEntry{Pattern: "^/mnt/[^/]+$", Type: IgnoreType_RegExp, Allow: true}},
+		{"glob:#x", IgnoreEntry{Pattern: "#x", Type: IgnoreType_Glob}},
+		{"/a:b/**", IgnoreEntry{Pattern: "/a:b/**", Type: IgnoreType_Glob}},
+	}
+	for _, tt := range tests {
+		got, err := parseIgnoreLine(tt.line)
+		if err != nil {
+			t.Errorf("parseIgnoreLine(%q): %s", tt.line, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseIgnoreLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+	for _, line := range []string{"!", "glob:", "!prefix:"} {
+		if _, err := parseIgnoreLine(line); err == nil {
+			t.Errorf("parseIgnoreLine(%q): want an error", line)
+		}
+	}
+}
+
+func TestIgnoreLineRoundTrip(t *testing.T) {
+	entries := []IgnoreEntry{
+		{Pattern: "/tmp/**", Type: IgnoreType_Glob},
+		{Pattern: "/tmp/keep", Type: IgnoreType_Prefix, Allow: true},
+		{Pattern: "^/mnt/[^/]+$", Type: IgnoreType_RegExp},
+		{Pattern: "!bang", Type: IgnoreType_Glob},
+		{Pattern: "#hash", Type: IgnoreType_Glob, Allow: true},
+		{Pattern: "prefix:odd", Type: IgnoreType_Glob},
+		{Pattern: "glob:odd", Type: IgnoreType_RegExp},
+	}
+	for _, e := range entries {
+		line := formatIgnoreLine(&e)
+		got, err := parseIgnoreLine(line)
+		if err != nil {
+			t.Errorf("parseIgnoreLine(%q): %s", line, err)
+			continue
+		}
+		if got != e {
+			t.Errorf("%+v was formatted as %q and parsed as %+v", e, line, got)
+		}
+	}
+}
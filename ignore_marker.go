@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A directory containing IGNORE_MARKER_FILE opts out of history with all its
+// subdirectories, no matter what the ignore list says. If the file contains
+// rules (in the format of `changedir ignore load`), only the matching
+// subdirectories are ignored. Rules are relative to the directory of the file:
+// it is "/" itself, so that "/build/**" matches its build subdirectory and
+// "build" matches build directories at any depth, like in .gitignore. Broken
+// rules never match.
+const IGNORE_MARKER_FILE = ".changedirignore"
+
+// IgnoreMarkers finds marker files which exclude directories. Marker files are
+// read once, so that checking many directories of the same tree is cheap.
+type IgnoreMarkers struct {
+	// nil if a directory has no marker file
+	files map[string]*ignoreMarkerFile
+}
+
+type ignoreMarkerFile struct {
+	path string
+	// the file has no rules and excludes the whole tree
+	all   bool
+	rules []IgnoreEntryCompiled
+}
+
+func newIgnoreMarkers() *IgnoreMarkers {
+	return &IgnoreMarkers{files: map[string]*ignoreMarkerFile{}}
+}
+
+func (m *IgnoreMarkers) load(dir string) *ignoreMarkerFile {
+	if f, ok := m.files[dir]; ok {
+		return f
+	}
+	var f *ignoreMarkerFile
+	path := filepath.Join(dir, IGNORE_MARKER_FILE)
+	if _, err := os.Lstat(path); err == nil {
+		f = &ignoreMarkerFile{path: path}
+		list, err := readIgnoreMarkerRules(path)
+		if err != nil || len(list) == 0 {
+			// unreadable files exclude the whole tree as well
+			f.all = true
+		}
+		f.rules, _ = compileIgnoreList(list)
+	}
+	m.files[dir] = f
+	return f
+}
+
+func readIgnoreMarkerRules(path string) ([]IgnoreEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var list []IgnoreEntry
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := parseIgnoreLine(line)
+		if err != nil {
+			continue
+		}
+		switch e.Type {
+		case IgnoreType_Glob:
+			if strings.Contains(e.Pattern, "/") && !strings.HasPrefix(e.Pattern, "/") && !strings.HasPrefix(e.Pattern, "**/") {
+				// "a/b" is relative to the marker directory as well
+				e.Pattern = "/" + e.Pattern
+			}
+		case IgnoreType_Prefix:
+			if !strings.HasPrefix(e.Pattern, "/") {
+				e.Pattern = "/" + e.Pattern
+			}
+		}
+		list = append(list, e)
+	}
+	return list, s.Err()
+}
+
+// Find returns the path of the marker file which excludes dir, or an empty
+// string. Marker files of dir and all its parent directories are checked.
+func (m *IgnoreMarkers) Find(dir string) string {
+	if !filepath.IsAbs(dir) {
+		return ""
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if f := m.load(d); f != nil && f.excludes(d, dir) {
+			return f.path
+		}
+		if d == "/" {
+			return ""
+		}
+	}
+}
+
+func (f *ignoreMarkerFile) excludes(root, dir string) bool {
+	if f.all {
+		return true
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return false
+	}
+	if rel == "." {
+		rel = ""
+	}
+	return isIgnored(f.rules, []byte("/"+rel))
+}
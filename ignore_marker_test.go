@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMarkersFind(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	markers := map[string]string{
+		"empty":  "# no rules\n",
+		"rules":  "build\n/out/**\n!/out/keep/**\n",
+		"broken": "/x/[b\nregexp:(\n",
+	}
+	for dir, data := range markers {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, IGNORE_MARKER_FILE), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// directories don't have to exist, only marker files are checked
+	tests := []struct {
+		dir    string
+		marker string
+	}{
+		{"empty", "empty"},
+		{"empty/a/b", "empty"},
+		{"rules", ""},
+		{"rules/a", ""},
+		{"rules/build", "rules"},
+		{"rules/a/build", "rules"},
+		{"rules/builds", ""},
+		{"rules/out", "rules"},
+		{"rules/out/x", "rules"},
+		{"rules/out/keep", ""},
+		{"rules/out/keep/x", ""},
+		{"rules/outx", ""},
+		{"broken", ""},
+		{"broken/x", ""},
+		{"none/a", ""},
+	}
+	m := newIgnoreMarkers()
+	for _, tt := range tests {
+		want := ""
+		if tt.marker != "" {
+			want = filepath.Join(root, tt.marker, IGNORE_MARKER_FILE)
+		}
+		if got := m.Find(filepath.Join(root, tt.dir)); got != want {
+			t.Errorf("Find(%q) = %q, want %q", tt.dir, got, want)
+		}
+	}
+	if got := m.Find("empty"); got != "" {
+		t.Errorf("Find of a relative path = %q, want an empty string", got)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	tests := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"/tmp/**", "/tmp", true},
+		{"/tmp/**", "/tmp/a/b", true},
+		{"/tmp/**", "/tmpx", false},
+		{"/tmp/*", "/tmp/a", true},
+		{"/tmp/*", "/tmp/a/b", false},
+		{"/tmp/*", "/tmp", false},
+		{"~/src/**/build", "/home/me/src/build", true},
+		{"~/src/**/build", "/home/me/src/a/b/build", true},
+		{"~/src/**/build", "/home/me/src/builds", false},
+		{"~/src/**/build", "/home/me/srcx/build", false},
+		{"**/build", "/a/build", true},
+		{"**/build", "/build", true},
+		{"**/build", "/a/build/x", false},
+		{"node_modules", "/a/node_modules", true},
+		{"node_modules", "/a/node_modules/b", true},
+		{"node_modules", "/a/node_modules2", false},
+		{"/a/?", "/a/b", true},
+		{"/a/?", "/a/bc", false},
+		{"/a/?", "/a//", false},
+		{"/a/[bc]", "/a/c", true},
+		{"/a/[!x]", "/a/y", true},
+		{"/a/[!x]", "/a/x", false},
+		{"/a/[]]", "/a/]", true},
+		{`/a/\*`, "/a/*", true},
+		{`/a/\*`, "/a/b", false},
+		{"/a.b", "/axb", false},
+	}
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.glob)
+		if err != nil {
+			t.Errorf("globToRegexp(%q): %s", tt.glob, err)
+			continue
+		}
+		if got := regexp.MustCompile(re).MatchString(tt.path); got != tt.match {
+			t.Errorf("glob %q (regexp %q) on %q: got %v, want %v", tt.glob, re, tt.path, got, tt.match)
+		}
+	}
+}
+
+func TestGlobToRegexpErrors(t *testing.T) {
+	for _, glob := range []string{"a/b", "/a/[b", "*/b"} {
+		if re, err := globToRegexp(glob); err == nil {
+			t.Errorf("globToRegexp(%q) = %q, want an error", glob, re)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/adrg/xdg"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Importers which seed history from shell history files. Targets of cd and
+// pushd commands are extracted and resolved to absolute paths. Shells don't
+// record working directories, so relative targets are resolved by replaying
+// the commands starting from the home directory, and are only kept if the
+// result is an existing directory.
+
+type shellCommand struct {
+	Text string
+	Time time.Time
+}
+
+func defaultFishHistoryPath() (string, error) {
+	return filepath.Join(xdg.DataHome, "fish", "fish_history"), nil
+}
+
+func defaultBashHistoryPath() (string, error) {
+	return homeFile(".bash_history")
+}
+
+func defaultZshHistoryPath() (string, error) {
+	return homeFile(".zsh_history")
+}
+
+func readFishHistory(r io.Reader, modTime time.Time) ([]ExportDirectory, error) {
+	var cmds []shellCommand
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "- cmd: ") {
+			text := unescapeFishHistory(line[len("- cmd: "):])
+			cmds = append(cmds, shellCommand{Text: text, Time: modTime})
+		} else if strings.HasPrefix(line, "  when: ") && len(cmds) > 0 {
+			if t, err := strconv.ParseInt(line[len("  when: "):], 10, 64); err == nil {
+				cmds[len(cmds)-1].Time = time.Unix(t, 0)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return shellHistoryDirectories(cmds), nil
+}
+
+// unescapeFishHistory undoes escaping of newlines and backslashes in fish
+// history commands.
+func unescapeFishHistory(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// readBashHistory reads plain bash history, with timestamps in "#<unix time>"
+// lines when HISTTIMEFORMAT was set.
+func readBashHistory(r io.Reader, modTime time.Time) ([]ExportDirectory, error) {
+	var cmds []shellCommand
+	t := modTime
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "#") {
+			if n, err := strconv.ParseInt(line[1:], 10, 64); err == nil {
+				t = time.Unix(n, 0)
+				continue
+			}
+		}
+		cmds = append(cmds, shellCommand{Text: line, Time: t})
+		t = modTime
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return shellHistoryDirectories(cmds), nil
+}
+
+// readZshHistory reads both plain and extended (": <time>:<duration>;<cmd>")
+// zsh history. Multi-line commands are continued with a trailing backslash.
+func readZshHistory(r io.Reader, modTime time.Time) ([]ExportDirectory, error) {
+	var cmds []shellCommand
+	continued := false
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := unmetafyZsh(s.Bytes())
+		if continued {
+			c := &cmds[len(cmds)-1]
+			c.Text += "\n" + strings.TrimSuffix(line, "\\")
+			continued = strings.HasSuffix(line, "\\")
+			continue
+		}
+		c := shellCommand{Text: line, Time: modTime}
+		if strings.HasPrefix(line, ": ") {
+			if header, text, ok := strings.Cut(line[2:], ";"); ok {
+				ts, _, _ := strings.Cut(header, ":")
+				if n, err := strconv.ParseInt(ts, 10, 64); err == nil {
+					c.Time = time.Unix(n, 0)
+					c.Text = text
+				}
+			}
+		}
+		continued = strings.HasSuffix(c.Text, "\\")
+		c.Text = strings.TrimSuffix(c.Text, "\\")
+		cmds = append(cmds, c)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return shellHistoryDirectories(cmds), nil
+}
+
+// unmetafyZsh decodes zsh "metafied" bytes: 0x83 followed by a byte xor 32.
+func unmetafyZsh(b []byte) string {
+	if bytes.IndexByte(b, 0x83) == -1 {
+		return string(b)
+	}
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] == 0x83 && i+1 < len(b) {
+			i++
+			out = append(out, b[i]^32)
+		} else {
+			out = append(out, b[i])
+		}
+	}
+	return string(out)
+}
+
+// shellHistoryDirectories replays commands in order and collects resolved cd
+// targets. Each cd counts as a visit.
+func shellHistoryDirectories(cmds []shellCommand) []ExportDirectory {
+	home, _ := os.UserHomeDir()
+	cwd := home
+	index := map[string]int{}
+	var out []ExportDirectory
+	for _, c := range cmds {
+		for _, target := range cdTargets(c.Text) {
+			dir, ok := resolveCDTarget(target, cwd, home)
+			if !ok {
+				continue
+			}
+			cwd = dir
+			if i, ok := index[dir]; ok {
+				d := &out[i]
+				d.Visits++
+				if c.Time.After(d.AccessTime) {
+					d.AccessTime = c.Time
+				}
+				continue
+			}
+			index[dir] = len(out)
+			out = append(out, ExportDirectory{Path: dir, AccessTime: c.Time, Visits: 1})
+		}
+	}
+	return out
+}
+
+func resolveCDTarget(target, cwd, home string) (string, bool) {
+	if strings.ContainsAny(target, "$`*?([{") {
+		// needs expansion we can't do
+		return "", false
+	}
+	switch {
+	case target == "~":
+		target = home
+	case strings.HasPrefix(target, "~/"):
+		target = filepath.Join(home, target[2:])
+	case strings.HasPrefix(target, "~"):
+		// other user's home
+		return "", false
+	}
+	if filepath.IsAbs(target) {
+		return filepath.Clean(target), true
+	}
+	if cwd == "" {
+		return "", false
+	}
+	dir := filepath.Join(cwd, target)
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return "", false
+	}
+	return dir, true
+}
+
+// shellPrefixWords may precede a command in the same simple command.
+var shellPrefixWords = map[string]bool{
+	"builtin": true,
+	"command": true,
+	"do":      true,
+	"then":    true,
+	"else":    true,
+}
+
+// cdTargets returns targets of all cd and pushd commands in a command line.
+// A cd without arguments is returned as "~", "cd -" is skipped.
+func cdTargets(text string) []string {
+	var out []string
+	for _, words := range splitShellCommands(text) {
+		for len(words) > 0 && shellPrefixWords[words[0]] {
+			words = words[1:]
+		}
+		if len(words) == 0 || (words[0] != "cd" && words[0] != "pushd") {
+			continue
+		}
+		target := "~"
+		for _, w := range words[1:] {
+			if w == "--" {
+				continue
+			}
+			if strings.HasPrefix(w, "-") {
+				if w == "-" {
+					target = ""
+					break
+				}
+				// options like -P or -L
+				continue
+			}
+			target = w
+			break
+		}
+		if target != "" {
+			out = append(out, target)
+		}
+	}
+	return out
+}
+
+// splitShellCommands is a very rough shell parser. It splits text into
+// simple commands on ';', '&', '|' and newlines, and commands into words,
+// handling quotes and backslash escapes.
+func splitShellCommands(text string) [][]string {
+	var out [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(words) > 0 {
+			out = append(out, words)
+			words = nil
+		}
+	}
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch c {
+		case ' ', '\t':
+			endWord()
+		case ';', '&', '|', '\n':
+			endCommand()
+		case '\\':
+			inWord = true
+			if i+1 < len(text) {
+				i++
+				word.WriteByte(text[i])
+			}
+		case '\'', '"':
+			inWord = true
+			j := strings.IndexByte(text[i+1:], c)
+			if j == -1 {
+				word.WriteString(text[i+1:])
+				i = len(text)
+			} else {
+				word.WriteString(text[i+1 : i+1+j])
+				i += j + 1
+			}
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+	endCommand()
+	return out
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitShellCommands(t *testing.T) {
+	tests := []struct {
+		text string
+		want [][]string
+	}{
+		{"", nil},
+		{"ls -l", [][]string{{"ls", "-l"}}},
+		{"cd /tmp && ls; pwd | cat\necho", [][]string{{"cd", "/tmp"}, {"ls"}, {"pwd"}, {"cat"}, {"echo"}}},
+		{`cd 'a b' "c;d" e\ f`, [][]string{{"cd", "a b", "c;d", "e f"}}},
+		{`cd a''b ""`, [][]string{{"cd", "ab", ""}}},
+		{"cd 'unterminated", [][]string{{"cd", "unterminated"}}},
+	}
+	for _, tt := range tests {
+		if got := splitShellCommands(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitShellCommands(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCdTargets(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"ls /tmp", nil},
+		{"cd /tmp", []string{"/tmp"}},
+		{"cd", []string{"~"}},
+		{"cd -", nil},
+		{"cd -P -- src", []string{"src"}},
+		{"builtin cd foo; command pushd 'a b'", []string{"foo", "a b"}},
+		{"make && cd build && cd ..", []string{"build", ".."}},
+	}
+	for _, tt := range tests {
+		if got := cdTargets(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("cdTargets(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/adrg/xdg"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Importers for databases of other directory jumpers and shell history files
+// (see import_shell.go). Each one reads the tool's on-disk format and returns
+// the directories section of an export, which is then merged as usual by
+// importExport.
+
+type importer struct {
+	defaultPath func() (string, error)
+	read        func(r io.Reader, modTime time.Time) ([]ExportDirectory, error)
+}
+
+var IMPORTERS = map[string]importer{
+	"zoxide":   {defaultZoxidePath, readZoxide},
+	"z":        {defaultZPath, readZ},
+	"autojump": {defaultAutojumpPath, readAutojump},
+	"fasd":     {defaultFasdPath, readFasd},
+	"fish":     {defaultFishHistoryPath, readFishHistory},
+	"bash":     {defaultBashHistoryPath, readBashHistory},
+	"zsh":      {defaultZshHistoryPath, readZshHistory},
+}
+
+func homeFile(name string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, name), nil
+}
+
+// rankToVisits maps scores of other tools to visit counts. Scores are roughly
+// visit counts with some aging applied, so rounding is good enough.
+func rankToVisits(rank float64) uint64 {
+	if math.IsNaN(rank) || rank < 1 {
+		return 1
+	}
+	return uint64(math.Round(rank))
+}
+
+func defaultZoxidePath() (string, error) {
+	if dir := os.Getenv("_ZO_DATA_DIR"); dir != "" {
+		return filepath.Join(dir, "db.zo"), nil
+	}
+	return filepath.Join(xdg.DataHome, "zoxide", "db.zo"), nil
+}
+
+const ZOXIDE_DB_VERSION = 3
+
+var errZoxideTruncated = errors.New("zoxide database is truncated")
+
+// readZoxide reads zoxide's bincode-serialized database: u32 version followed
+// by u64 number of entries, each entry is a u64 length prefixed path, f64 rank
+// and u64 last access time in unix seconds. Everything is little endian.
+func readZoxide(r io.Reader, modTime time.Time) ([]ExportDirectory, error) {
+	br := bufio.NewReader(r)
+	var version uint32
+	if err := binary.Read(br, binary.LittleEndian, &version); err != nil {
+		return nil, errZoxideTruncated
+	}
+	if version != ZOXIDE_DB_VERSION {
+		return nil, fmt.Errorf("Unsupported zoxide database version %d, only version %d is supported", version, ZOXIDE_DB_VERSION)
+	}
+	var n uint64
+	if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+		return nil, errZoxideTruncated
+	}
+	var out []ExportDirectory
+	for i := uint64(0); i < n; i++ {
+		var pathLen uint64
+		if err := binary.Read(br, binary.LittleEndian, &pathLen); err != nil {
+			return nil, errZoxideTruncated
+		}
+		if pathLen > 1<<16 {
+			return nil, fmt.Errorf("zoxide database is corrupted (path length %d)", pathLen)
+		}
+		path := make([]byte, pathLen)
+		if _, err := io.ReadFull(br, path); err != nil {
+			return nil, errZoxideTruncated
+		}
+		var entry struct {
+			Rank         float64
+			LastAccessed uint64
+		}
+		if err := binary.Read(br, binary.LittleEndian, &entry); err != nil {
+			return nil, errZoxideTruncated
+		}
+		out = append(out, ExportDirectory{
+			Path:       string(path),
+			AccessTime: time.Unix(int64(entry.LastAccessed), 0),
+			Visits:     rankToVisits(entry.Rank),
+		})
+	}
+	return out, nil
+}
+
+func defaultZPath() (string, error) {
+	if path := os.Getenv("_Z_DATA"); path != "" {
+		return path, nil
+	}
+	return homeFile(".z")
+}
+
+func defaultFasdPath() (string, error) {
+	if path := os.Getenv("_FASD_DATA"); path != "" {
+		return path, nil
+	}
+	return homeFile(".fasd")
+}
+
+// readZ reads "path|rank|time" lines used by both z and fasd.
+func readZ(r io.Reader, modTime time.Time) ([]ExportDirectory, error) {
+	var out []ExportDirectory
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		// paths may contain '|', but rank and time may not
+		i := strings.LastIndexByte(text, '|')
+		j := -1
+		if i > 0 {
+			j = strings.LastIndexByte(text[:i], '|')
+		}
+		if j <= 0 {
+			return nil, fmt.Errorf("Line %d: expected \"path|rank|time\"", line)
+		}
+		rank, err := strconv.ParseFloat(text[j+1:i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line, err)
+		}
+		t, err := strconv.ParseInt(text[i+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line, err)
+		}
+		out = append(out, ExportDirectory{
+			Path:       text[:j],
+			AccessTime: time.Unix(t, 0),
+			Visits:     rankToVisits(rank),
+		})
+	}
+	return out, s.Err()
+}
+
+// readFasd is the same as readZ, except fasd tracks files too, so only
+// entries which are directories are kept.
+func readFasd(r io.Reader, modTime time.Time) ([]ExportDirectory, error) {
+	list, err := readZ(r, modTime)
+	if err != nil {
+		return nil, err
+	}
+	out := list[:0]
+	for _, d := range list {
+		if fi, err := os.Stat(d.Path); err == nil && fi.IsDir() {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func defaultAutojumpPath() (string, error) {
+	if runtime.GOOS == "darwin" {
+		return homeFile("Library/autojump/autojump.txt")
+	}
+	return filepath.Join(xdg.DataHome, "autojump", "autojump.txt"), nil
+}
+
+// readAutojump reads "weight<TAB>path" lines. Autojump doesn't store access
+// times, the modification time of the file is used instead.
+func readAutojump(r io.Reader, modTime time.Time) ([]ExportDirectory, error) {
+	var out []ExportDirectory
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		weight, path, ok := strings.Cut(text, "\t")
+		if !ok {
+			return nil, fmt.Errorf("Line %d: expected \"weight<TAB>path\"", line)
+		}
+		rank, err := strconv.ParseFloat(weight, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", line, err)
+		}
+		out = append(out, ExportDirectory{
+			Path:       path,
+			AccessTime: modTime,
+			Visits:     rankToVisits(rank),
+		})
+	}
+	return out, s.Err()
+}
+
+// readForeignExport reads a database of another tool, if path is empty the
+// tool's default location is used. Directories matching the ignore list are
+// dropped.
+func readForeignExport(imp importer, path string, regexps []IgnoreEntryCompiled) (*Export, error) {
+	if path == "" {
+		var err error
+		if path, err = imp.defaultPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	modTime := time.Now()
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if fi, err := file.Stat(); err == nil {
+			modTime = fi.ModTime()
+		}
+		in = file
+	}
+
+	list, err := imp.read(in, modTime)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	dirs := make([]ExportDirectory, 0, len(list))
+	markers := newIgnoreMarkers()
+	for _, d := range list {
+		if !filepath.IsAbs(d.Path) {
+			continue
+		}
+		d.Path = filepath.Clean(d.Path)
+		// the same check put does
+		if isIgnored(regexps, []byte(d.Path)) || markers.Find(d.Path) != "" {
+			continue
+		}
+		dirs = append(dirs, d)
+	}
+	return &Export{
+		Format:      "changedir",
+		Version:     EXPORT_FORMAT_VERSION,
+		Directories: &dirs,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func zoxideDB(version uint32, paths []string, ranks []float64, times []uint64) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, version)
+	binary.Write(&b, binary.LittleEndian, uint64(len(paths)))
+	for i, p := range paths {
+		binary.Write(&b, binary.LittleEndian, uint64(len(p)))
+		b.WriteString(p)
+		binary.Write(&b, binary.LittleEndian, ranks[i])
+		binary.Write(&b, binary.LittleEndian, times[i])
+	}
+	return b.Bytes()
+}
+
+func TestReadZoxide(t *testing.T) {
+	data := zoxideDB(ZOXIDE_DB_VERSION, []string{"/a", "/b c"}, []float64{12.6, 0.2}, []uint64{1700000000, 1600000000})
+	got, err := readZoxide(bytes.NewReader(data), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ExportDirectory{
+		{Path: "/a", AccessTime: time.Unix(1700000000, 0), Visits: 13},
+		{Path: "/b c", AccessTime: time.Unix(1600000000, 0), Visits: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := readZoxide(bytes.NewReader(data[:len(data)-3]), time.Time{}); err != errZoxideTruncated {
+		t.Errorf("truncated database: got %v, want %v", err, errZoxideTruncated)
+	}
+	data = zoxideDB(ZOXIDE_DB_VERSION+1, nil, nil, nil)
+	if _, err := readZoxide(bytes.NewReader(data), time.Time{}); err == nil {
+		t.Errorf("unsupported version: want an error")
+	}
+}
+
+func TestReadZ(t *testing.T) {
+	got, err := readZ(strings.NewReader("/a|12.6|1700000000\n\n/b|c|0.5|1600000000\n"), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ExportDirectory{
+		{Path: "/a", AccessTime: time.Unix(1700000000, 0), Visits: 13},
+		{Path: "/b|c", AccessTime: time.Unix(1600000000, 0), Visits: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	for _, text := range []string{"/a", "/a|1", "|1|2", "/a|x|2", "/a|1|x"} {
+		if _, err := readZ(strings.NewReader(text), time.Time{}); err == nil {
+			t.Errorf("readZ(%q): want an error", text)
+		}
+	}
+}
@@ -9,17 +9,23 @@ const fishCD = `
 function cd --wraps cd --description "cd wrapper which records directories history"
     builtin cd $argv
     if status is-interactive
-        changedir put $PWD
+        changedir put --session "$CHANGEDIR_SESSION" $PWD
     end
 end
 `
 
 const fishCDInteractive = `
 function cd-interactive --description "go to directory based on history (interactive)"
+    # arguments are passed to changedir list or pick, e.g. "cd-interactive --here"
     # clear the line and move cursor to the beginning of the line (less flickering in some terminals)
     echo -ne "\033[2K\r"
-    set -l destdir (changedir list | fzf --scheme=path --reverse --no-sort --no-info)
-    if test $status -eq 0
+    set -l destdir
+    if type -q fzf
+        set destdir (changedir list --sort=frecency $argv | fzf --scheme=path --reverse --no-sort --no-info)
+    else
+        set destdir (changedir pick --sort=frecency $argv)
+    end
+    if test -n "$destdir"
         cd $destdir
     end
     commandline -f repaint
@@ -28,7 +34,15 @@ end
 
 const fishConfig = `
 if status is-interactive
+    # session id for changedir back/forward, tmux panes keep it across shell restarts
+    if set -q TMUX_PANE
+        set -gx CHANGEDIR_SESSION tmux$TMUX_PANE
+    else
+        set -gx CHANGEDIR_SESSION fish$fish_pid
+    end
     bind \cl cd-interactive
+    # same, but only directories within the current project
+    bind \el 'cd-interactive --here'
 end
 `
 
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ListOptions are the options shared by commands which show a ranked list of
+// directories: list and pick.
+type ListOptions struct {
+	sortName  *string
+	since     *string
+	until     *string
+	bookmarks *bool
+	tags      stringList
+	under     *string
+	match     *string
+	existing  *bool
+	limit     *int
+	tilde     *bool
+	projects  *bool
+	here      *bool
+}
+
+func addListOptions(cmd *flag.FlagSet) *ListOptions {
+	o := &ListOptions{}
+	o.sortName = cmd.String("sort", "", "sort order: \"recent\" or \"frecency\" (default is \"frecency\" with --projects, otherwise \"recent\")")
+	o.since = cmd.String("since", "", "only list directories visited after this time (duration like \"3d\" or date like \"2023-01-31 14:00\")")
+	o.until = cmd.String("until", "", "only list directories visited before this time (same format as --since)")
+	o.bookmarks = cmd.Bool("bookmarks", true, "list bookmarked directories first")
+	cmd.Var(&o.tags, "tag", "only list directories with this tag (can be given multiple times)")
+	o.under = cmd.String("under", "", "only list this directory and its subdirectories")
+	o.here = cmd.Bool("here", false, "only list directories within the project of the current directory, see below")
+	o.match = cmd.String("match", "", "only list directories matching this regexp")
+	o.existing = cmd.Bool("existing", false, "skip directories which no longer exist (without removing them)")
+	o.limit = cmd.Int("limit", 0, "list at most this many directories (0 means no limit)")
+	o.projects = cmd.Bool("projects", false, "list project roots instead of directories, see below")
+	o.tilde = cmd.Bool("tilde", false, "show directories under $HOME as \"~/...\"")
+	return o
+}
+
+const listOptionsHelp = `By default most recently stored directories go first. Frecency order combines the number of visits with the time of the last visit, frequently visited directories go first unless they were not visited for a long time.
+
+When --since or --until is given, directories are looked up in the visit log (see ` + "`changedir log`" + `) and both orders only take visits within the time range into account.
+
+With --here only the project containing the current directory is listed, the same way as with --under. The project root is detected the same way put does it (see project.markers config), if the current directory is not within a project, the current directory itself is used.
+
+With --projects directories are replaced by their project roots (see ` + "`changedir put`" + `), directories outside of projects are skipped. A project root combines visits of all its directories and its access time is the most recent one among them. Roots are sorted by frecency by default, so the most active projects go first. Only bookmarks which are project roots are listed.
+
+Bookmarked directories (see ` + "`changedir bookmark`" + `) are listed first, ordered by alias. Bookmarked directories which are not in history are listed too, unless --since or --until is given. All other filters apply to bookmarks as well.
+`
+
+// isUnder reports whether path is dir or one of its subdirectories.
+func isUnder(path, dir string) bool {
+	if !strings.HasPrefix(path, dir) {
+		return false
+	}
+	return len(path) == len(dir) || strings.HasSuffix(dir, "/") || path[len(dir)] == '/'
+}
+
+// getDirectoryListUnder is getDirectoryList limited to dir and its
+// subdirectories. Keys are sorted, so only the relevant range is scanned (for
+// both absolute and home-relative keys). If $HOME is under dir, all
+// home-relative keys are scanned.
+func getDirectoryListUnder(db *bbolt.DB, dir string) []DirectoryEntry {
+	prefixes := directoryKeys([]byte(dir))
+	if home := homeDir(); home != "" && home != dir && isUnder(home, dir) {
+		prefixes = append(prefixes, []byte("~"))
+	}
+	var out []DirectoryEntry
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(BUCKET_DIRECTORIES).Cursor()
+		for _, prefix := range prefixes {
+			p := string(prefix)
+			for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), p); k, v = c.Next() {
+				if !isUnder(string(k), p) {
+					continue
+				}
+				e, err := decodeDirectoryEntry(append([]byte(nil), k...), v)
+				if err != nil {
+					return err
+				}
+				out = append(out, e)
+			}
+		}
+		return nil
+	}))
+	return out
+}
+
+// getHereDir returns the project root of the current directory or the
+// current directory itself if it's not within a project.
+func getHereDir(db *bbolt.DB) string {
+	cwd := fatalr(canonicalPath(".", getResolveSymlinks(db)))
+	var root string
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		root = findProjectRoot(cwd, getProjectMarkers(tx))
+		return nil
+	}))
+	if root == "" {
+		return cwd
+	}
+	return root
+}
+
+// Load returns directories according to the options: filtered, sorted, with
+// bookmarks pinned and limited.
+func (o *ListOptions) Load(db *bbolt.DB) []DirectoryEntry {
+	now := time.Now()
+	sortName := *o.sortName
+	if sortName == "" {
+		sortName = "recent"
+		if *o.projects {
+			// rank by the combined activity of the project
+			sortName = "frecency"
+		}
+	}
+	order := fatalr(parseSortOrder(sortName))
+	var match *regexp.Regexp
+	if *o.match != "" {
+		match = fatalr(regexp.Compile(*o.match))
+	}
+	under := ""
+	if *o.under != "" {
+		under = fatalr(canonicalPath(*o.under, false))
+	}
+	if *o.here {
+		if under != "" {
+			fatal(fmt.Errorf("Options --here and --under can't be used together"))
+		}
+		under = getHereDir(db)
+	}
+
+	var out []DirectoryEntry
+	inRange := *o.since != "" || *o.until != ""
+	if inRange {
+		var since, until time.Time
+		if *o.since != "" {
+			since = fatalr(parseTimeArg(*o.since, now))
+		}
+		if *o.until != "" {
+			until = fatalr(parseTimeArg(*o.until, now))
+		}
+		out = getDirectoryListInRange(db, since, until)
+	} else if under != "" {
+		out = getDirectoryListUnder(db, under)
+	} else {
+		out = getDirectoryList(db)
+	}
+	if *o.projects {
+		out = collapseProjects(out)
+	}
+	sortDirectoryList(out, order, now)
+	if *o.bookmarks {
+		// with --projects only bookmarked project roots are pinned
+		out = pinBookmarks(db, out, !inRange && !*o.projects)
+	}
+
+	filtered := out[:0]
+	for _, e := range out {
+		if *o.limit > 0 && len(filtered) >= *o.limit {
+			break
+		}
+		path := string(e.Path)
+		if under != "" && !isUnder(path, under) {
+			continue
+		}
+		if len(o.tags) > 0 && !e.HasAllTags(o.tags) {
+			continue
+		}
+		if match != nil && !match.MatchString(path) {
+			continue
+		}
+		if *o.existing {
+			if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+				continue
+			}
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered
+}
+
+// Home returns the home directory to abbreviate to "~" in displayed paths,
+// empty if paths are displayed as is.
+func (o *ListOptions) Home() string {
+	if *o.tilde {
+		return homeDir()
+	}
+	return ""
+}
+
+func printListOptionsHelp(cmd *flag.FlagSet) {
+	fmt.Fprintf(cmd.Output(), "\n%s", ww(listOptionsHelp))
+}
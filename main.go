@@ -2,7 +2,6 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/binary"
 	"flag"
 	"fmt"
@@ -10,8 +9,7 @@ import (
 	"github.com/mitchellh/go-wordwrap"
 	"go.etcd.io/bbolt"
 	"os"
-	"regexp"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -22,23 +20,40 @@ func ww(s string) string {
 
 var BUCKET_DIRECTORIES = []byte("directories")
 var BUCKET_IGNORES = []byte("ignores")
+var BUCKET_VISITS = []byte("visits")
+var BUCKET_META = []byte("meta")
+var BUCKET_CONFIG = []byte("config")
+var BUCKET_BOOKMARKS = []byte("bookmarks")
+var BUCKET_SESSIONS = []byte("sessions")
 
 var ALL_BUCKETS = [][]byte{
+	BUCKET_META,
 	BUCKET_DIRECTORIES,
 	BUCKET_IGNORES,
+	BUCKET_VISITS,
+	BUCKET_CONFIG,
+	BUCKET_BOOKMARKS,
+	BUCKET_SESSIONS,
 }
 
 type DirectoryEntry struct {
-	Path       []byte
-	AccessTime []byte
+	Path       []byte    `json:"-"`
+	AccessTime time.Time `json:"atime"`
+	Visits     uint64    `json:"visits"`
+	Tags       []string  `json:"tags,omitempty"`
+	Project    string    `json:"project,omitempty"`
 }
 
-type IgnoreEntry struct {
-	RegExp []byte
+type VisitEntry struct {
+	Path    string    `json:"path"`
+	Time    time.Time `json:"-"`
+	Session string    `json:"session,omitempty"`
 }
 
-type IgnoreEntryCompiled struct {
-	RegExp *regexp.Regexp
+type BookmarkEntry struct {
+	Alias   string    `json:"-"`
+	Path    string    `json:"path"`
+	Created time.Time `json:"created"`
 }
 
 func fatal(err error) {
@@ -77,6 +92,7 @@ func loadDB() *bbolt.DB {
 	db := fatalr(bbolt.Open(getDBPath(), 0600, nil))
 	defer closeDB(&db)
 
+	fatal(migrateDB(db, getDBPath()))
 	fatal(db.Update(func(tx *bbolt.Tx) error {
 		for _, b := range ALL_BUCKETS {
 			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
@@ -94,71 +110,90 @@ func loadDB() *bbolt.DB {
 func commandList(db *bbolt.DB, args []string) {
 	cmd := flag.NewFlagSet("changedir list", flag.ExitOnError)
 	timestamps := cmd.Bool("time", false, "add timestamps to output (tab separated)")
+	format := cmd.String("format", "text", OUTPUT_FORMAT_USAGE)
+	options := addListOptions(cmd)
 	cmd.Usage = func() {
 		fmt.Fprintf(cmd.Output(), "Usage: changedir list [options]\n")
-		fmt.Fprintf(cmd.Output(), ww("\nList all directories in most recently stored first order.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nList all directories, or only the ones passing the filters given as options.\n"))
+		printListOptionsHelp(cmd)
+		fmt.Fprintf(cmd.Output(), ww("\nTSV columns are: path, access time, visit count, comma separated tags and project root. JSON objects contain the same fields: \"path\", \"atime\", \"visits\", \"tags\" and \"project\" (the last two are omitted if empty). Paths are always absolute in these formats, --tilde only affects text output.\n"))
 		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
 		cmd.PrintDefaults()
 	}
 	cmd.Parse(args)
 
-	var out []DirectoryEntry
-	fatal(db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(BUCKET_DIRECTORIES)
-		n := b.Stats().KeyN
-		out = make([]DirectoryEntry, 0, n)
-		return b.ForEach(func(k, v []byte) error {
-			out = append(out, DirectoryEntry{
-				Path:       k,
-				AccessTime: v,
-			})
-			return nil
-		})
-	}))
-	sort.Slice(out, func(i, j int) bool {
-		a, b := out[i], out[j]
-		return bytes.Compare(a.AccessTime, b.AccessTime) == 1
-	})
-	w := bufio.NewWriter(os.Stdout)
+	rw := newRecordWriter(fatalr(parseOutputFormat(*format)))
+	out := options.Load(db)
+	home := options.Home()
 	for _, e := range out {
-		if *timestamps {
-			fatalr(w.Write(e.AccessTime))
-			fatal(w.WriteByte('\t'))
-		}
-		fatalr(w.Write(e.Path))
-		fatal(w.WriteByte('\n'))
+		rw.Write(newDirectoryRecord(&e), func(w *bufio.Writer) {
+			if *timestamps {
+				fatalr(w.WriteString(e.AccessTime.Format(time.RFC3339)))
+				fatal(w.WriteByte('\t'))
+			}
+			fatalr(w.WriteString(contractHome(string(e.Path), home)))
+			fatal(w.WriteByte('\n'))
+		})
 	}
-	fatal(w.Flush())
+	rw.Close()
 }
 
 func commandPut(db *bbolt.DB, args []string) {
 	cmd := flag.NewFlagSet("changedir put", flag.ExitOnError)
+	session := cmd.String("session", "", "shell session id to record in the visit log and session stack (default is CHANGEDIR_SESSION environment variable)")
 	cmd.Usage = func() {
-		fmt.Fprintf(cmd.Output(), "Usage: changedir put [directory]\n")
-		fmt.Fprintf(cmd.Output(), ww("\nPut a directory to history unless it passes a check from ignore list. If directory is empty or argument is missing, the command silently does nothing.\n"))
+		fmt.Fprintf(cmd.Output(), "Usage: changedir put [options] [directory]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nPut a directory to history unless it passes a check from ignore list or it's excluded by a .changedirignore file in it or one of its parent directories (see `changedir ignore apply`). If directory is empty or argument is missing, the command silently does nothing. The directory is made absolute relative to the current directory and cleaned, symlinks are resolved if put.resolve-symlinks config is true. The closest parent directory containing one of project.markers is remembered as the project root of the directory. Every visit is also appended to the visit log. If there is a session id, the directory is pushed to the navigation stack of the session (see `changedir back`), ignored directories are pushed as well. Retention policy from the config is applied at most once per hour.\n"))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
 		cmd.PrintDefaults()
 	}
 	cmd.Parse(args)
 
-	now := []byte(time.Now().UTC().Format(time.RFC3339))
+	now := time.Now().UTC().Truncate(time.Second)
 	dirString := strings.TrimSpace(cmd.Arg(0))
 	if dirString == "" {
 		// do nothing
 		return
 	}
+	dirString = fatalr(canonicalPath(dirString, getResolveSymlinks(db)))
 	dir := []byte(dirString)
 
-	regexps := compileIgnoreList(getIgnoreList(db))
-	for _, r := range regexps {
-		if r.RegExp.Match(dir) {
-			// this entry must be ignored
-			return
-		}
+	// navigation history includes ignored directories, otherwise back would
+	// skip them
+	sessionID := getSessionID(*session)
+	if sessionID != "" {
+		fatal(db.Update(func(tx *bbolt.Tx) error {
+			return pushSession(tx, sessionID, dirString, now)
+		}))
+	}
+
+	regexps := loadIgnoreList(db)
+	if isIgnored(regexps, dir) || newIgnoreMarkers().Find(dirString) != "" {
+		// this entry must be ignored
+		return
 	}
 
 	fatal(db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(BUCKET_DIRECTORIES)
-		return b.Put(dir, now)
+		e, _, err := getDirectoryEntry(b, dir)
+		if err != nil {
+			return err
+		}
+		e.Project = findProjectRoot(dirString, getProjectMarkers(tx))
+		e.AccessTime = now
+		e.Visits++
+		if err := putDirectoryEntry(b, &e); err != nil {
+			return err
+		}
+		err = putVisitEntry(tx.Bucket(BUCKET_VISITS), &VisitEntry{
+			Path:    dirString,
+			Time:    time.Now(),
+			Session: sessionID,
+		})
+		if err != nil {
+			return err
+		}
+		return applyRetentionPolicy(tx, now, false, dir)
 	}))
 }
 
@@ -166,7 +201,7 @@ func commandRemove(db *bbolt.DB, args []string) {
 	cmd := flag.NewFlagSet("changedir remove", flag.ExitOnError)
 	cmd.Usage = func() {
 		fmt.Fprintf(cmd.Output(), "Usage: changedir remove [directory]\n")
-		fmt.Fprintf(cmd.Output(), ww("\nRemove a directory from history. If directory is empty or argument is missing, the command silently does nothing.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nRemove a directory from history. If directory is empty or argument is missing, the command silently does nothing. Both the directory as given and its canonical form (see put) are removed.\n"))
 		cmd.PrintDefaults()
 	}
 	cmd.Parse(args)
@@ -176,10 +211,13 @@ func commandRemove(db *bbolt.DB, args []string) {
 		// do nothing
 		return
 	}
-	dir := []byte(dirString)
+	canonical := fatalr(canonicalPath(dirString, getResolveSymlinks(db)))
 	fatal(db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(BUCKET_DIRECTORIES)
-		return b.Delete(dir)
+		if err := b.Delete([]byte(dirString)); err != nil {
+			return err
+		}
+		return deleteDirectoryEntry(b, []byte(canonical))
 	}))
 }
 
@@ -208,144 +246,116 @@ func commandInstall(db *bbolt.DB, args []string) {
 func commandPrune(db *bbolt.DB, args []string) {
 	cmd := flag.NewFlagSet("changedir prune", flag.ExitOnError)
 	dry := cmd.Bool("dry", false, "only print the results without actually removing anything")
+	olderThan := cmd.String("older-than", "", "also remove directories not visited for this long, e.g. \"180d\" (default is retention.max-age config)")
+	keep := cmd.String("keep", "", "also remove least recently visited directories, keeping at most this many, 0 means no limit (default is retention.max-entries config)")
+	format := cmd.String("format", "text", OUTPUT_FORMAT_USAGE)
 	cmd.Usage = func() {
 		fmt.Fprintf(cmd.Output(), "Usage: changedir prune [options]\n")
-		fmt.Fprintf(cmd.Output(), ww("\nRemove non-existent directories from history. Also removes entries which are not a directory.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nRemove non-existent directories from history. Also removes entries which are not a directory and directories excluded by .changedirignore files. Bookmarked directories are never removed.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nAfter that the retention policy is applied: directories not visited for too long are removed, then least recently visited directories are removed if there are too many. The policy is taken from the config (see `changedir config list`), which is also applied automatically during put, and can be overridden with options. Visit log entries older than the maximum age are removed too.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nTSV columns are: path and reason. JSON objects contain the same fields: \"path\" and \"reason\". Reason is one of: \"missing\", \"notadir\", \"marker\" (excluded by a .changedirignore file, see `changedir ignore apply`), \"expired\" or \"excess\".\n"))
 		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
 		cmd.PrintDefaults()
 	}
 	cmd.Parse(args)
 
+	now := time.Now()
+	var policy RetentionPolicy
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		var err error
+		policy, err = getRetentionPolicy(tx)
+		return err
+	}))
+	if *olderThan != "" {
+		policy.MaxAge = fatalr(parseDuration(*olderThan))
+	}
+	if *keep != "" {
+		fatal(validateUint(*keep))
+		policy.MaxEntries = fatalr(strconv.Atoi(*keep))
+	}
+
 	var toRemove [][]byte
-	w := bufio.NewWriter(os.Stdout)
+	var rest []DirectoryEntry
+	rw := newRecordWriter(fatalr(parseOutputFormat(*format)))
+	report := func(path []byte, reason string) {
+		toRemove = append(toRemove, path)
+		rw.Write(&RemovedRecord{Path: string(path), Reason: reason}, func(w *bufio.Writer) {
+			fmt.Fprintf(w, "%-10s%s\n", "["+strings.ToUpper(reason)+"]", path)
+		})
+	}
+	markers := newIgnoreMarkers()
 	fatal(db.View(func(tx *bbolt.Tx) error {
+		bookmarked, err := getBookmarkedPaths(tx)
+		if err != nil {
+			return err
+		}
 		b := tx.Bucket(BUCKET_DIRECTORIES)
-		return b.ForEach(func(k, v []byte) error {
-			fi, err := os.Stat(string(k))
+		err = b.ForEach(func(k, v []byte) error {
+			e, err := decodeDirectoryEntry(k, v)
+			if err != nil {
+				return err
+			}
+			if bookmarked[string(e.Path)] {
+				return nil
+			}
+			fi, err := os.Stat(string(e.Path))
 			isNotExist := os.IsNotExist(err)
 			notDir := err == nil && !fi.IsDir()
-			if isNotExist || notDir {
-				toRemove = append(toRemove, k)
-				if isNotExist {
-					fatalr(w.WriteString("[MISSING] "))
-				} else {
-					fatalr(w.WriteString("[NOTADIR] "))
-				}
-				fatalr(w.Write(k))
-				fatal(w.WriteByte('\n'))
+			if isNotExist {
+				report(e.Path, "missing")
+				return nil
+			}
+			if notDir {
+				report(e.Path, "notadir")
+				return nil
 			}
+			if markers.Find(string(e.Path)) != "" {
+				report(e.Path, "marker")
+				return nil
+			}
+			rest = append(rest, e)
 			return nil
 		})
+		if err != nil {
+			return err
+		}
+		for _, c := range retentionCandidates(rest, policy, now, nil) {
+			switch c.Reason {
+			case RetentionReason_Expired:
+				report(c.Path, "expired")
+			case RetentionReason_Excess:
+				report(c.Path, "excess")
+			}
+		}
+		return nil
 	}))
-	fatal(w.Flush())
+	rw.Close()
 
 	if !*dry {
 		fatal(db.Update(func(tx *bbolt.Tx) error {
 			b := tx.Bucket(BUCKET_DIRECTORIES)
 			for _, k := range toRemove {
-				if err := b.Delete(k); err != nil {
+				if err := deleteDirectoryEntry(b, k); err != nil {
 					return err
 				}
 			}
+			if policy.MaxAge != 0 {
+				return trimVisitLog(tx, now.Add(-policy.MaxAge))
+			}
 			return nil
 		}))
 	}
 }
 
-func getIgnoreList(db *bbolt.DB) []IgnoreEntry {
-	var out []IgnoreEntry
-	fatal(db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(BUCKET_IGNORES)
-		out = make([]IgnoreEntry, 0, b.Stats().KeyN)
-		return b.ForEach(func(k, v []byte) error {
-			out = append(out, IgnoreEntry{RegExp: k})
-			return nil
-		})
-	}))
-	return out
-}
-
-func compileIgnoreList(list []IgnoreEntry) []IgnoreEntryCompiled {
-	out := make([]IgnoreEntryCompiled, 0, len(list))
-	for _, v := range list {
-		r, err := regexp.Compile(string(v.RegExp))
-		if err == nil {
-			out = append(out, IgnoreEntryCompiled{RegExp: r})
-		}
-	}
-	return out
-}
-
-func commandIgnoreList(db *bbolt.DB, args []string) {
-	cmd := flag.NewFlagSet("changedir ignore list", flag.ExitOnError)
-	cmd.Usage = func() {
-		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore list\n")
-		fmt.Fprintf(cmd.Output(), ww("\nList all regexps from ignore list. All regexps are enclosed in '' quotes, this is to help you see spaces in regexps, which are allowed.\n"))
-		cmd.PrintDefaults()
-	}
-	cmd.Parse(args)
-
-	regexps := getIgnoreList(db)
-	w := bufio.NewWriter(os.Stdout)
-	for _, r := range regexps {
-		fatal(w.WriteByte('\''))
-		fatalr(w.Write(r.RegExp))
-		fatal(w.WriteByte('\''))
-		fatal(w.WriteByte('\n'))
-	}
-	fatal(w.Flush())
-}
-
-func commandIgnorePut(db *bbolt.DB, args []string) {
-	cmd := flag.NewFlagSet("changedir ignore put", flag.ExitOnError)
-	cmd.Usage = func() {
-		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore put <regexp>\n")
-		fmt.Fprintf(cmd.Output(), ww("\nAdd a regexp to the list. Matching directories will not be stored.\n"))
-		cmd.PrintDefaults()
-	}
-	cmd.Parse(args)
-
-	regexpString := cmd.Arg(0)
-	if regexpString == "" {
-		cmd.Usage()
-		return
-	}
-
-	regexp := []byte(regexpString)
-	fatal(db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(BUCKET_IGNORES)
-		return b.Put(regexp, nil)
-	}))
-}
-
-func commandIgnoreRemove(db *bbolt.DB, args []string) {
-	cmd := flag.NewFlagSet("changedir ignore remove", flag.ExitOnError)
-	cmd.Usage = func() {
-		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore remove <regexp>\n")
-		fmt.Fprintf(cmd.Output(), ww("\nRemove a regexp from the list.\n"))
-		cmd.PrintDefaults()
-	}
-	cmd.Parse(args)
-
-	regexpString := cmd.Arg(0)
-	if regexpString == "" {
-		// do nothing
-		return
-	}
-	regexp := []byte(regexpString)
-
-	fatal(db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(BUCKET_IGNORES)
-		return b.Delete(regexp)
-	}))
-}
-
 func commandIgnoreApply(db *bbolt.DB, args []string) {
 	cmd := flag.NewFlagSet("changedir ignore apply", flag.ExitOnError)
 	dry := cmd.Bool("dry", false, "only print the results without actually removing anything")
+	format := cmd.String("format", "text", OUTPUT_FORMAT_USAGE)
 	cmd.Usage = func() {
 		fmt.Fprintf(cmd.Output(), "Usage: changedir ignore apply [options]\n")
-		fmt.Fprintf(cmd.Output(), ww("\nApply ignore list to existing entries. The command will print out deleted directories.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nApply ignore list and .changedirignore files to existing entries. The command will print out deleted directories. Bookmarked directories are never removed.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nA directory containing a .changedirignore file is excluded from history with all its subdirectories, e.g. a vendored SDK or a build output tree can opt itself out for everyone. If the file contains rules in the format of `changedir ignore load`, only matching subdirectories are excluded. Rules are relative to the directory of the file, e.g. \"/out/**\" matches its out subdirectory and \"build\" matches build directories at any depth, like in .gitignore. Regexps are matched against the path relative to the directory of the file, which is \"/\" itself.\n"))
+		fmt.Fprintf(cmd.Output(), ww("\nTSV columns are: path and reason (\"ignored\" for ignore list or \"marker\" for .changedirignore files). JSON objects contain the same fields: \"path\" and \"reason\".\n"))
 		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
 		cmd.PrintDefaults()
 	}
@@ -355,33 +365,47 @@ func commandIgnoreApply(db *bbolt.DB, args []string) {
 
 	var toRemove [][]byte
 
-	regexps := compileIgnoreList(getIgnoreList(db))
-	w := bufio.NewWriter(os.Stdout)
+	regexps := loadIgnoreList(db)
+	markers := newIgnoreMarkers()
+	rw := newRecordWriter(fatalr(parseOutputFormat(*format)))
 	fatal(db.View(func(tx *bbolt.Tx) error {
+		bookmarked, err := getBookmarkedPaths(tx)
+		if err != nil {
+			return err
+		}
 		b := tx.Bucket(BUCKET_DIRECTORIES)
 		return b.ForEach(func(k, v []byte) error {
-			matches := false
-			for _, r := range regexps {
-				if r.RegExp.Match(k) {
-					matches = true
-					break
-				}
+			p, err := expandHomeKey(string(k))
+			if err != nil {
+				return err
+			}
+			path := []byte(p)
+			if bookmarked[string(path)] {
+				return nil
 			}
-			if matches {
-				toRemove = append(toRemove, k)
-				fatalr(w.Write(k))
-				fatal(w.WriteByte('\n'))
+			reason := ""
+			if isIgnored(regexps, path) {
+				reason = "ignored"
+			} else if markers.Find(string(path)) != "" {
+				reason = "marker"
+			}
+			if reason != "" {
+				toRemove = append(toRemove, path)
+				rw.Write(&RemovedRecord{Path: string(path), Reason: reason}, func(w *bufio.Writer) {
+					fatalr(w.Write(path))
+					fatal(w.WriteByte('\n'))
+				})
 			}
 			return nil
 		})
 	}))
-	fatal(w.Flush())
+	rw.Close()
 
 	if !*dry {
 		fatal(db.Update(func(tx *bbolt.Tx) error {
 			b := tx.Bucket(BUCKET_DIRECTORIES)
 			for _, k := range toRemove {
-				if err := b.Delete(k); err != nil {
+				if err := deleteDirectoryEntry(b, k); err != nil {
 					return err
 				}
 			}
@@ -407,13 +431,38 @@ func main() {
 		fmt.Fprintf(o, ww("\nUtility that helps you maintain visited directories history. You can get help for any command using -h flag, e.g.: `changedir ignore apply -h`.\n"))
 		fmt.Fprintf(o, "\nAvailable commands:\n")
 		fmt.Fprintf(o, "  list             list all directories\n")
+		fmt.Fprintf(o, "  pick             pick a directory interactively\n")
+		fmt.Fprintf(o, "  query            print the best matching directory\n")
 		fmt.Fprintf(o, "  put              put a directory to history\n")
 		fmt.Fprintf(o, "  remove           remove a directory from history\n")
-		fmt.Fprintf(o, "  prune            remove non-existent directories from history\n")
-		fmt.Fprintf(o, "  ignore list      list all regexps from ignore list\n")
-		fmt.Fprintf(o, "  ignore put       put a regexp to ignore list\n")
-		fmt.Fprintf(o, "  ignore remove    remove a regexp from ignore list\n")
+		fmt.Fprintf(o, "  normalize        merge duplicate directories in history\n")
+		fmt.Fprintf(o, "  log              show the log of all visits\n")
+		fmt.Fprintf(o, "  back             print the previous directory of the shell session\n")
+		fmt.Fprintf(o, "  forward          print the next directory of the shell session\n")
+		fmt.Fprintf(o, "  stats            show history statistics\n")
+		fmt.Fprintf(o, "  tag list         list tags\n")
+		fmt.Fprintf(o, "  tag add          attach tags to a directory\n")
+		fmt.Fprintf(o, "  tag remove       remove tags from a directory\n")
+		fmt.Fprintf(o, "  resolve          print the directory of a bookmark\n")
+		fmt.Fprintf(o, "  bookmark list    list all bookmarks\n")
+		fmt.Fprintf(o, "  bookmark add     bookmark a directory under an alias\n")
+		fmt.Fprintf(o, "  bookmark remove  remove a bookmark\n")
+		fmt.Fprintf(o, "  prune            remove non-existent and expired directories from history\n")
+		fmt.Fprintf(o, "  ignore list      list all rules from ignore list\n")
+		fmt.Fprintf(o, "  ignore put       put a rule to ignore list\n")
+		fmt.Fprintf(o, "  ignore remove    remove a rule from ignore list\n")
+		fmt.Fprintf(o, "  ignore move      reorder rules of ignore list\n")
+		fmt.Fprintf(o, "  ignore check     list broken rules from ignore list\n")
+		fmt.Fprintf(o, "  ignore test      explain how ignore list applies to directories\n")
+		fmt.Fprintf(o, "  ignore load      load ignore list from a file\n")
+		fmt.Fprintf(o, "  ignore save      save ignore list to a file\n")
 		fmt.Fprintf(o, "  ignore apply     apply ignore list to existing entries\n")
+		fmt.Fprintf(o, "  export           export history and ignore list\n")
+		fmt.Fprintf(o, "  import           import history and ignore list\n")
+		fmt.Fprintf(o, "  config list      list all config keys and values\n")
+		fmt.Fprintf(o, "  config get       print a config value\n")
+		fmt.Fprintf(o, "  config set       set a config value\n")
+		fmt.Fprintf(o, "  config unset     unset a config value\n")
 		fmt.Fprintf(o, "  install          install shell integration (interactive)\n")
 		fmt.Fprintf(o, "\nDatabase location:\n")
 		fmt.Fprintf(o, "  %s\n", getDBPath())
@@ -432,14 +481,72 @@ func main() {
 		cmd.Usage()
 	case "list":
 		commandList(db, args)
+	case "pick":
+		commandPick(db, args)
+	case "query":
+		commandQuery(db, args)
 	case "put":
 		commandPut(db, args)
 	case "remove":
 		commandRemove(db, args)
+	case "normalize":
+		commandNormalize(db, args)
+	case "log":
+		commandLog(db, args)
+	case "back":
+		commandBack(db, args)
+	case "forward":
+		commandForward(db, args)
+	case "stats":
+		commandStats(db, args)
 	case "prune":
 		commandPrune(db, args)
+	case "export":
+		commandExport(db, args)
+	case "import":
+		commandImport(db, args)
 	case "install":
 		commandInstall(db, args)
+	case "tag":
+		subCommand, args := getSubCommand(args)
+		switch subCommand {
+		default:
+			cmd.Usage()
+		case "list":
+			commandTagList(db, args)
+		case "add":
+			commandTagAdd(db, args)
+		case "remove":
+			commandTagRemove(db, args)
+		}
+	case "resolve":
+		commandResolve(db, args)
+	case "bookmark":
+		subCommand, args := getSubCommand(args)
+		switch subCommand {
+		default:
+			cmd.Usage()
+		case "list":
+			commandBookmarkList(db, args)
+		case "add":
+			commandBookmarkAdd(db, args)
+		case "remove":
+			commandBookmarkRemove(db, args)
+		}
+	case "config":
+		subCommand, args := getSubCommand(args)
+		switch subCommand {
+		default:
+			cmd.Usage()
+		case "list":
+			commandConfigList(db, args)
+		case "get":
+			commandConfigGet(db, args)
+		case "set":
+			commandConfigSet(db, args)
+		case "unset":
+			commandConfigUnset(db, args)
+		}
 	case "ignore":
 		subCommand, args := getSubCommand(args)
 		switch subCommand {
@@ -451,6 +558,16 @@ func main() {
 			commandIgnorePut(db, args)
 		case "remove":
 			commandIgnoreRemove(db, args)
+		case "move":
+			commandIgnoreMove(db, args)
+		case "check":
+			commandIgnoreCheck(db, args)
+		case "test":
+			commandIgnoreTest(db, args)
+		case "load":
+			commandIgnoreLoad(db, args)
+		case "save":
+			commandIgnoreSave(db, args)
 		case "apply":
 			commandIgnoreApply(db, args)
 		}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"time"
+)
+
+var META_SCHEMA_VERSION = []byte("schema_version")
+
+type Migration struct {
+	Description string
+	Apply       func(tx *bbolt.Tx) error
+}
+
+// MIGRATIONS[i] upgrades the database from schema version i to version i+1.
+// Version 0 is the original layout without the meta bucket. Never change or
+// remove existing migrations, append new ones instead.
+var MIGRATIONS = []Migration{
+	{"convert history entries from RFC3339 timestamps to JSON records", migrateDirectoryRecords},
+	{"store ignore rules in order", migrateIgnoreOrder},
+}
+
+var SCHEMA_VERSION = uint64(len(MIGRATIONS))
+
+func getSchemaVersion(tx *bbolt.Tx) uint64 {
+	if b := tx.Bucket(BUCKET_META); b != nil {
+		if v := b.Get(META_SCHEMA_VERSION); len(v) == 8 {
+			return btoi(v)
+		}
+	}
+	if tx.Bucket(BUCKET_DIRECTORIES) == nil {
+		// brand new database, nothing to migrate
+		return SCHEMA_VERSION
+	}
+	return 0
+}
+
+func setSchemaVersion(tx *bbolt.Tx, version uint64) error {
+	b, err := tx.CreateBucketIfNotExists(BUCKET_META)
+	if err != nil {
+		return err
+	}
+	return b.Put(META_SCHEMA_VERSION, itob(version))
+}
+
+// migrateDB brings the database to SCHEMA_VERSION. Before applying any
+// migrations a copy of the database is saved next to it. All migrations are
+// applied in a single transaction, so the database is never left half
+// upgraded.
+func migrateDB(db *bbolt.DB, path string) error {
+	var version uint64
+	if err := db.View(func(tx *bbolt.Tx) error {
+		version = getSchemaVersion(tx)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if version > SCHEMA_VERSION {
+		return fmt.Errorf("Database schema version is %d, but this version of changedir supports up to %d, please, upgrade changedir", version, SCHEMA_VERSION)
+	}
+	if version == SCHEMA_VERSION {
+		return db.Update(func(tx *bbolt.Tx) error {
+			if tx.Bucket(BUCKET_META) != nil {
+				return nil
+			}
+			return setSchemaVersion(tx, version)
+		})
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().Format("20060102-150405"))
+	if err := db.View(func(tx *bbolt.Tx) error {
+		return tx.CopyFile(backupPath, 0600)
+	}); err != nil {
+		return fmt.Errorf("Failed to back up the database before migration: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "changedir: database backup saved to %s\n", backupPath)
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		for ; version < SCHEMA_VERSION; version++ {
+			m := &MIGRATIONS[version]
+			fmt.Fprintf(os.Stderr, "changedir: migrating database to version %d: %s\n", version+1, m.Description)
+			if err := m.Apply(tx); err != nil {
+				return fmt.Errorf("Migration to version %d failed: %s", version+1, err)
+			}
+		}
+		return setSchemaVersion(tx, version)
+	})
+}
+
+func migrateDirectoryRecords(tx *bbolt.Tx) error {
+	b := tx.Bucket(BUCKET_DIRECTORIES)
+	var entries []DirectoryEntry
+	err := b.ForEach(func(k, v []byte) error {
+		if bytes.HasPrefix(v, []byte("{")) {
+			// already converted by a put
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, string(v))
+		if err != nil {
+			return fmt.Errorf("Bad history entry for %q: %s", k, err)
+		}
+		entries = append(entries, DirectoryEntry{
+			Path:       append([]byte(nil), k...),
+			AccessTime: t,
+			Visits:     1,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		v, err := encodeDirectoryEntry(&entries[i])
+		if err != nil {
+			return err
+		}
+		if err := b.Put(entries[i].Path, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateIgnoreOrder re-keys ignore entries by their order, patterns move to
+// JSON values. Entries were keyed by pattern before, with either an empty
+// value (regexp) or a JSON value with the type, their order is kept.
+func migrateIgnoreOrder(tx *bbolt.Tx) error {
+	type oldValue struct {
+		Type string `json:"type"`
+	}
+	type newValue struct {
+		Pattern string `json:"pattern"`
+		Type    string `json:"type"`
+	}
+	b := tx.Bucket(BUCKET_IGNORES)
+	if b == nil {
+		return nil
+	}
+	var values [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		nv := newValue{Pattern: string(k), Type: "regexp"}
+		if len(v) != 0 {
+			var ov oldValue
+			if err := json.Unmarshal(v, &ov); err != nil {
+				return fmt.Errorf("Bad ignore entry for %q: %s", k, err)
+			}
+			if ov.Type != "" {
+				nv.Type = ov.Type
+			}
+		}
+		data, err := json.Marshal(&nv)
+		if err != nil {
+			return err
+		}
+		values = append(values, data)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.DeleteBucket(BUCKET_IGNORES); err != nil {
+		return err
+	}
+	if b, err = tx.CreateBucket(BUCKET_IGNORES); err != nil {
+		return err
+	}
+	for i, v := range values {
+		if err := b.Put(itob(uint64(i+1)), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
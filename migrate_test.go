@@ -0,0 +1,240 @@
+package main
+
+import (
+	"go.etcd.io/bbolt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// openTestDB opens a new database in a temporary directory, setup (if any)
+// fills it before it's returned.
+func openTestDB(t *testing.T, setup func(tx *bbolt.Tx) error) (*bbolt.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "history.db")
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if setup != nil {
+		if err := db.Update(setup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, path
+}
+
+// createTestBuckets creates all buckets, the same way loadDB does.
+func createTestBuckets(tx *bbolt.Tx) error {
+	for _, b := range ALL_BUCKETS {
+		if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMigrateDB(t *testing.T) {
+	atime := time.Date(2023, 1, 31, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		setup   func(tx *bbolt.Tx) error
+		backup  bool
+		wantErr bool
+		want    []DirectoryEntry
+	}{
+		{
+			name:  "new database",
+			setup: func(tx *bbolt.Tx) error { return nil },
+		},
+		{
+			name: "version 0",
+			setup: func(tx *bbolt.Tx) error {
+				b, err := tx.CreateBucket(BUCKET_DIRECTORIES)
+				if err != nil {
+					return err
+				}
+				if err := b.Put([]byte("/a"), []byte(atime.Format(time.RFC3339))); err != nil {
+					return err
+				}
+				// converted by a put of a newer version already
+				return b.Put([]byte("/b"), []byte(`{"atime":"2023-01-31T14:00:00Z","visits":5}`))
+			},
+			backup: true,
+			want: []DirectoryEntry{
+				{Path: []byte("/a"), AccessTime: atime, Visits: 1},
+				{Path: []byte("/b"), AccessTime: atime, Visits: 5},
+			},
+		},
+		{
+			name: "version 0 with a broken entry",
+			setup: func(tx *bbolt.Tx) error {
+				b, err := tx.CreateBucket(BUCKET_DIRECTORIES)
+				if err != nil {
+					return err
+				}
+				return b.Put([]byte("/a"), []byte("yesterday"))
+			},
+			backup:  true,
+			wantErr: true,
+		},
+		{
+			name: "current version",
+			setup: func(tx *bbolt.Tx) error {
+				if err := createTestBuckets(tx); err != nil {
+					return err
+				}
+				return setSchemaVersion(tx, SCHEMA_VERSION)
+			},
+			want: []DirectoryEntry{},
+		},
+		{
+			name: "newer version",
+			setup: func(tx *bbolt.Tx) error {
+				if err := createTestBuckets(tx); err != nil {
+					return err
+				}
+				return setSchemaVersion(tx, SCHEMA_VERSION+1)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.setup)
+			err := migrateDB(db, path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("migrateDB: got error %v, want error: %v", err, tt.wantErr)
+			}
+			backups, _ := filepath.Glob(path + ".v*.bak")
+			if (len(backups) > 0) != tt.backup {
+				t.Errorf("got backups %q, want a backup: %v", backups, tt.backup)
+			}
+			if tt.wantErr {
+				return
+			}
+			err = db.View(func(tx *bbolt.Tx) error {
+				if v := getSchemaVersion(tx); v != SCHEMA_VERSION {
+					t.Errorf("schema version is %d, want %d", v, SCHEMA_VERSION)
+				}
+				if tt.want == nil {
+					return nil
+				}
+				b := tx.Bucket(BUCKET_DIRECTORIES)
+				got := []DirectoryEntry{}
+				err := b.ForEach(func(k, v []byte) error {
+					e, err := decodeDirectoryEntry(append([]byte(nil), k...), v)
+					got = append(got, e)
+					return err
+				})
+				if err != nil {
+					return err
+				}
+				if len(got) != len(tt.want) {
+					t.Fatalf("got %d entries, want %d", len(got), len(tt.want))
+				}
+				for i := range got {
+					g, w := &got[i], &tt.want[i]
+					if string(g.Path) != string(w.Path) || !g.AccessTime.Equal(w.AccessTime) || g.Visits != w.Visits {
+						t.Errorf("entry %d: got %+v, want %+v", i, *g, *w)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestMigrateIgnoreOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		old       map[string]string
+		noIgnores bool
+		wantErr   bool
+		want      []string
+	}{
+		{
+			name:      "no ignores bucket",
+			noIgnores: true,
+		},
+		{
+			name: "empty bucket",
+			old:  map[string]string{},
+			want: []string{},
+		},
+		{
+			name: "old entries",
+			old: map[string]string{
+				"^/tmp":        "",
+				"/a/**":        `{"type":"glob"}`,
+				"node_modules": `{"type":"glob"}`,
+				"^/b":          `{}`,
+			},
+			// old keys are in bytewise order
+			want: []string{
+				`{"pattern":"/a/**","type":"glob"}`,
+				`{"pattern":"^/b","type":"regexp"}`,
+				`{"pattern":"^/tmp","type":"regexp"}`,
+				`{"pattern":"node_modules","type":"glob"}`,
+			},
+		},
+		{
+			name:    "broken entry",
+			old:     map[string]string{"^/tmp": "glob"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, func(tx *bbolt.Tx) error {
+				if tt.noIgnores {
+					return nil
+				}
+				b, err := tx.CreateBucket(BUCKET_IGNORES)
+				if err != nil {
+					return err
+				}
+				for k, v := range tt.old {
+					if err := b.Put([]byte(k), []byte(v)); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			err := db.Update(func(tx *bbolt.Tx) error {
+				if err := migrateIgnoreOrder(tx); err != nil {
+					return err
+				}
+				b := tx.Bucket(BUCKET_IGNORES)
+				if b == nil {
+					if !tt.noIgnores {
+						t.Errorf("ignores bucket is missing")
+					}
+					return nil
+				}
+				got := []string{}
+				i := uint64(0)
+				err := b.ForEach(func(k, v []byte) error {
+					i++
+					if btoi(k) != i {
+						t.Errorf("entry %d has key %d", i, btoi(k))
+					}
+					got = append(got, string(v))
+					return nil
+				})
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+				return err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("migrateIgnoreOrder: got error %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
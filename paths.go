@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// canonicalPath makes a directory path absolute (relative to the current
+// working directory) and cleans it. If resolveSymlinks is true, symlinks are
+// resolved as well, unless the path doesn't exist.
+func canonicalPath(dir string, resolveSymlinks bool) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if resolveSymlinks {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+	}
+	return dir, nil
+}
+
+func getResolveSymlinks(db *bbolt.DB) bool {
+	var out bool
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		out = getConfigBool(tx, "put.resolve-symlinks")
+		return nil
+	}))
+	return out
+}
+
+func commandNormalize(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir normalize", flag.ExitOnError)
+	dry := cmd.Bool("dry", false, "only print the results without actually changing anything")
+	resolveSymlinks := cmd.Bool("resolve-symlinks", false, "resolve symlinks (default is put.resolve-symlinks config)")
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir normalize [options]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nBring existing history entries to the same form put uses: clean absolute paths, optionally with symlinks resolved, stored relative to $HOME if storage.home-relative config is true. Entries which end up being the same directory are merged: the newest access time is kept and visit counts are added up. Project roots of existing directories are detected again using project.markers config. The command will print out changed directories. Relative paths can't be fixed and are left as is.\n"))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	resolve := *resolveSymlinks || getResolveSymlinks(db)
+	home := homeDir()
+	var homeRelative bool
+	var markers []string
+	var keys [][]byte
+	var list []DirectoryEntry
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		homeRelative = isHomeRelative(tx)
+		markers = getProjectMarkers(tx)
+		return tx.Bucket(BUCKET_DIRECTORIES).ForEach(func(k, v []byte) error {
+			k = append([]byte(nil), k...)
+			e, err := decodeDirectoryEntry(k, v)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, k)
+			list = append(list, e)
+			return nil
+		})
+	}))
+
+	changed := false
+	w := bufio.NewWriter(os.Stdout)
+	toRemove, toPut, err := normalizeDirectoryList(w, keys, list, resolve, homeRelative, home)
+	fatal(err)
+	for _, e := range toPut {
+		if fi, err := os.Stat(string(e.Path)); err != nil || !fi.IsDir() {
+			// keep the last known project root
+			continue
+		}
+		project := findProjectRoot(string(e.Path), markers)
+		if project == e.Project {
+			continue
+		}
+		if project == "" {
+			fmt.Fprintf(w, "[PROJECT] %s: -\n", e.Path)
+		} else {
+			fmt.Fprintf(w, "[PROJECT] %s: %s\n", e.Path, project)
+		}
+		e.Project = project
+		changed = true
+	}
+	fatal(w.Flush())
+
+	if !*dry && (len(toRemove) > 0 || changed) {
+		fatal(db.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(BUCKET_DIRECTORIES)
+			for _, k := range toRemove {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			for _, e := range toPut {
+				if err := putDirectoryEntry(b, e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+}
+
+// normalizeDirectoryList brings entries to the form put uses, keys[i] is the
+// key list[i] is stored under. Returns keys which should be removed and entries
+// which should be stored, entries of the same directory are merged into one.
+// Changed keys are reported to w, relative paths are left as is.
+func normalizeDirectoryList(w io.Writer, keys [][]byte, list []DirectoryEntry, resolve, homeRelative bool, home string) ([][]byte, []*DirectoryEntry, error) {
+	merged := map[string]*DirectoryEntry{}
+	var toRemove [][]byte
+	var toPut []*DirectoryEntry
+	for i := range list {
+		e := &list[i]
+		key := string(keys[i])
+		path := string(e.Path)
+		if !filepath.IsAbs(path) {
+			fmt.Fprintf(w, "[RELATIVE] %s\n", key)
+			continue
+		}
+		canonical, err := canonicalPath(path, resolve)
+		if err != nil {
+			return nil, nil, err
+		}
+		newKey := canonical
+		if homeRelative {
+			newKey = contractHome(canonical, home)
+		}
+		if newKey != key {
+			fmt.Fprintf(w, "%s -> %s\n", key, newKey)
+			toRemove = append(toRemove, keys[i])
+		}
+		if m, ok := merged[canonical]; ok {
+			mergeVisits(m, e)
+		} else {
+			e.Path = []byte(canonical)
+			merged[canonical] = e
+			toPut = append(toPut, e)
+		}
+	}
+	return toRemove, toPut, nil
+}
+
+// mergeVisits merges two entries of the same directory.
+func mergeVisits(dst, src *DirectoryEntry) {
+	if src.AccessTime.After(dst.AccessTime) {
+		dst.AccessTime = src.AccessTime
+	}
+	dst.Visits += src.Visits
+	dst.Tags = unionTags(dst.Tags, src.Tags)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testEntry struct {
+	key    string
+	path   string
+	visits uint64
+}
+
+// runNormalize returns removed keys and stored entries as "path:visits:n",
+// where n is the index of the entry the access time comes from.
+func runNormalize(t *testing.T, entries []testEntry, resolve, homeRelative bool, home string) ([]string, []string) {
+	t.Helper()
+	now := time.Date(2023, 1, 31, 14, 0, 0, 0, time.UTC)
+	var keys [][]byte
+	var list []DirectoryEntry
+	for i, e := range entries {
+		keys = append(keys, []byte(e.key))
+		list = append(list, DirectoryEntry{
+			Path:       []byte(e.path),
+			Visits:     e.visits,
+			AccessTime: now.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	toRemove, toPut, err := normalizeDirectoryList(io.Discard, keys, list, resolve, homeRelative, home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed := []string{}
+	for _, k := range toRemove {
+		removed = append(removed, string(k))
+	}
+	stored := []string{}
+	for _, e := range toPut {
+		n := int(e.AccessTime.Sub(now) / time.Hour)
+		stored = append(stored, string(e.Path)+":"+strconv.FormatUint(e.Visits, 10)+":"+strconv.Itoa(n))
+	}
+	return removed, stored
+}
+
+func TestNormalizeDirectoryList(t *testing.T) {
+	home := "/home/me"
+	tests := []struct {
+		name         string
+		entries      []testEntry
+		homeRelative bool
+		removed      []string
+		stored       []string
+	}{
+		{
+			name:    "clean paths",
+			entries: []testEntry{{"/a", "/a", 1}, {"/b", "/b", 2}},
+			removed: []string{},
+			stored:  []string{"/a:1:0", "/b:2:1"},
+		},
+		{
+			name:    "same directory is merged",
+			entries: []testEntry{{"/a/", "/a/", 1}, {"/a", "/a", 2}, {"/a/./x/..", "/a/./x/..", 3}},
+			removed: []string{"/a/", "/a/./x/.."},
+			stored:  []string{"/a:6:2"},
+		},
+		{
+			name:    "relative paths are left as is",
+			entries: []testEntry{{"foo", "foo", 1}, {"/b", "/b", 1}},
+			removed: []string{},
+			stored:  []string{"/b:1:1"},
+		},
+		{
+			name:         "home-relative storage",
+			entries:      []testEntry{{"/home/me/src", "/home/me/src", 1}, {"~/doc", "/home/me/doc", 1}, {"/tmp", "/tmp", 1}},
+			homeRelative: true,
+			removed:      []string{"/home/me/src"},
+			stored:       []string{"/home/me/src:1:0", "/home/me/doc:1:1", "/tmp:1:2"},
+		},
+		{
+			name:    "absolute storage",
+			entries: []testEntry{{"~/doc", "/home/me/doc", 1}, {"/home/me/doc", "/home/me/doc", 2}},
+			removed: []string{"~/doc"},
+			stored:  []string{"/home/me/doc:3:1"},
+		},
+	}
+	for _, tt := range tests {
+		removed, stored := runNormalize(t, tt.entries, false, tt.homeRelative, home)
+		if !reflect.DeepEqual(removed, tt.removed) {
+			t.Errorf("%s: removed %q, want %q", tt.name, removed, tt.removed)
+		}
+		if !reflect.DeepEqual(stored, tt.stored) {
+			t.Errorf("%s: stored %q, want %q", tt.name, stored, tt.stored)
+		}
+	}
+}
+
+func TestNormalizeDirectoryListSymlinks(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	real := filepath.Join(dir, "real")
+	link := filepath.Join(dir, "link")
+	if err := os.Mkdir(real, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+	entries := []testEntry{{link, link, 1}, {real, real, 2}}
+
+	removed, stored := runNormalize(t, entries, false, false, "")
+	if len(removed) != 0 || len(stored) != 2 {
+		t.Errorf("without resolving: removed %q, stored %q", removed, stored)
+	}
+	removed, stored = runNormalize(t, entries, true, false, "")
+	if want := []string{link}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed %q, want %q", removed, want)
+	}
+	if want := []string{real + ":3:1"}; !reflect.DeepEqual(stored, want) {
+		t.Errorf("stored %q, want %q", stored, want)
+	}
+}
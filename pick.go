@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"golang.org/x/term"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Picker is a full-screen interactive directory picker. It runs on the
+// controlling terminal, so that stdout can be captured by the shell.
+type Picker struct {
+	db       *bbolt.DB
+	tty      *os.File
+	home     string
+	all      []DirectoryEntry
+	filtered []DirectoryEntry
+	query    []byte
+	selected int
+	offset   int
+	status   string
+}
+
+const pickerHelp = "enter: select  esc: cancel  ctrl-d: remove from history  ctrl-x: ignore"
+
+func (p *Picker) filter() {
+	m := newQueryMatcher(strings.Fields(string(p.query)))
+	p.filtered = p.filtered[:0]
+	for _, e := range p.all {
+		if ok, _ := m.Match(string(e.Path)); ok {
+			p.filtered = append(p.filtered, e)
+		}
+	}
+	p.selected = 0
+	p.offset = 0
+}
+
+func (p *Picker) move(delta int) {
+	p.selected += delta
+	if p.selected >= len(p.filtered) {
+		p.selected = len(p.filtered) - 1
+	}
+	if p.selected < 0 {
+		p.selected = 0
+	}
+}
+
+// fitLine truncates a line to the given width, for paths the beginning is
+// cut off since the end is more interesting.
+func fitLine(s string, width int, cutStart bool) string {
+	n := utf8.RuneCountInString(s)
+	if n <= width || width < 1 {
+		return s
+	}
+	r := []rune(s)
+	if cutStart {
+		return "…" + string(r[n-width+1:])
+	}
+	return string(r[:width-1]) + "…"
+}
+
+func (p *Picker) render() error {
+	width, height, err := term.GetSize(int(p.tty.Fd()))
+	if err != nil {
+		return err
+	}
+	// prompt, counter and help lines
+	listHeight := height - 3
+	if listHeight < 1 {
+		listHeight = 1
+	}
+	if p.selected < p.offset {
+		p.offset = p.selected
+	}
+	if p.selected >= p.offset+listHeight {
+		p.offset = p.selected - listHeight + 1
+	}
+
+	var b bytes.Buffer
+	b.WriteString("\x1b[H\x1b[2K")
+	b.WriteString("\x1b[1m> \x1b[0m")
+	b.WriteString(fitLine(string(p.query), width-2, true))
+	b.WriteString("\r\n\x1b[2K\x1b[2m")
+	counter := fmt.Sprintf("  %d/%d", len(p.filtered), len(p.all))
+	if p.status != "" {
+		counter += "  " + p.status
+	}
+	b.WriteString(fitLine(counter, width, false))
+	b.WriteString("\x1b[0m")
+	for i := 0; i < listHeight; i++ {
+		b.WriteString("\r\n\x1b[2K")
+		idx := p.offset + i
+		if idx >= len(p.filtered) {
+			continue
+		}
+		line := fitLine(contractHome(string(p.filtered[idx].Path), p.home), width-2, true)
+		if idx == p.selected {
+			b.WriteString("\x1b[7m▶ ")
+			b.WriteString(line)
+			b.WriteString("\x1b[0m")
+		} else {
+			b.WriteString("  ")
+			b.WriteString(line)
+		}
+	}
+	b.WriteString("\r\n\x1b[2K\x1b[2m")
+	b.WriteString(fitLine(pickerHelp, width, false))
+	b.WriteString("\x1b[0m")
+	// put the cursor back to the prompt
+	fmt.Fprintf(&b, "\x1b[1;%dH", utf8.RuneCount(p.query)+3)
+	_, err = p.tty.Write(b.Bytes())
+	return err
+}
+
+// removeSelected removes the selected entry from history.
+func (p *Picker) removeSelected() error {
+	if len(p.filtered) == 0 {
+		return nil
+	}
+	path := p.filtered[p.selected].Path
+	err := p.db.Update(func(tx *bbolt.Tx) error {
+		return deleteDirectoryEntry(tx.Bucket(BUCKET_DIRECTORIES), path)
+	})
+	if err != nil {
+		return err
+	}
+	p.status = fmt.Sprintf("removed %s", path)
+	p.drop(func(e *DirectoryEntry) bool { return bytes.Equal(e.Path, path) })
+	return nil
+}
+
+// ignoreSelected adds a prefix ignore rule for the selected directory (i.e.
+// including all its subdirectories), and applies it right away.
+func (p *Picker) ignoreSelected() error {
+	if len(p.filtered) == 0 {
+		return nil
+	}
+	path := string(p.filtered[p.selected].Path)
+	rule := IgnoreEntry{Pattern: path, Type: IgnoreType_Prefix}
+	r, err := compileIgnoreEntry(&rule)
+	if err != nil {
+		return err
+	}
+	var removed int
+	var bookmarked map[string]bool
+	err = p.db.Update(func(tx *bbolt.Tx) error {
+		if _, err := appendIgnoreEntry(tx, &rule); err != nil {
+			return err
+		}
+		// bookmarked directories are never removed, the same as by ignore
+		// apply
+		bookmarked, err = getBookmarkedPaths(tx)
+		if err != nil {
+			return err
+		}
+		b := tx.Bucket(BUCKET_DIRECTORIES)
+		for _, e := range p.all {
+			if !r.Match(e.Path) || bookmarked[string(e.Path)] {
+				continue
+			}
+			// bookmarks which are not in history are listed too
+			_, ok, err := getDirectoryEntry(b, e.Path)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err := deleteDirectoryEntry(b, e.Path); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.status = fmt.Sprintf("ignored prefix '%s', removed %d entries", path, removed)
+	p.drop(func(e *DirectoryEntry) bool { return r.Match(e.Path) && !bookmarked[string(e.Path)] })
+	return nil
+}
+
+func (p *Picker) drop(fn func(e *DirectoryEntry) bool) {
+	for _, list := range []*[]DirectoryEntry{&p.all, &p.filtered} {
+		out := (*list)[:0]
+		for i := range *list {
+			if !fn(&(*list)[i]) {
+				out = append(out, (*list)[i])
+			}
+		}
+		*list = out
+	}
+	p.move(0)
+}
+
+// run returns the picked directory, or false if the picker was cancelled.
+func (p *Picker) run() (path string, ok bool, err error) {
+	fd := int(p.tty.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", false, err
+	}
+	// alternate screen
+	p.tty.WriteString("\x1b[?1049h")
+	defer func() {
+		p.tty.WriteString("\x1b[?1049l")
+		if lerr := term.Restore(fd, state); lerr != nil && err == nil {
+			err = lerr
+		}
+	}()
+
+	p.filter()
+	buf := make([]byte, 64)
+	for {
+		if err := p.render(); err != nil {
+			return "", false, err
+		}
+		n, err := p.tty.Read(buf)
+		if err != nil {
+			return "", false, err
+		}
+		input := buf[:n]
+		for len(input) > 0 {
+			key := input[0]
+			input = input[1:]
+			switch key {
+			case '\r', '\n':
+				if len(p.filtered) == 0 {
+					continue
+				}
+				return string(p.filtered[p.selected].Path), true, nil
+			case 0x03, 0x07: // ctrl-c, ctrl-g
+				return "", false, nil
+			case 0x1b:
+				if len(input) == 0 {
+					// plain escape
+					return "", false, nil
+				}
+				if input[0] != '[' && input[0] != 'O' {
+					continue
+				}
+				// CSI sequence: parameters, then a final byte
+				i := 1
+				for i < len(input) && input[i] >= 0x30 && input[i] <= 0x3f {
+					i++
+				}
+				if i >= len(input) {
+					input = nil
+					continue
+				}
+				seq := string(input[1 : i+1])
+				input = input[i+1:]
+				switch seq {
+				case "A":
+					p.move(-1)
+				case "B":
+					p.move(1)
+				case "5~":
+					p.move(-10)
+				case "6~":
+					p.move(10)
+				}
+			case 0x10, 0x0b: // ctrl-p, ctrl-k
+				p.move(-1)
+			case 0x0e: // ctrl-n
+				p.move(1)
+			case 0x7f, 0x08: // backspace
+				if len(p.query) > 0 {
+					_, size := utf8.DecodeLastRune(p.query)
+					p.query = p.query[:len(p.query)-size]
+					p.filter()
+				}
+			case 0x15: // ctrl-u
+				p.query = p.query[:0]
+				p.filter()
+			case 0x04: // ctrl-d
+				if err := p.removeSelected(); err != nil {
+					return "", false, err
+				}
+			case 0x18: // ctrl-x
+				if err := p.ignoreSelected(); err != nil {
+					return "", false, err
+				}
+			default:
+				if key >= 0x20 {
+					p.query = append(p.query, key)
+					if utf8.Valid(p.query) {
+						p.filter()
+					}
+				}
+			}
+		}
+	}
+}
+
+func commandPick(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir pick", flag.ExitOnError)
+	options := addListOptions(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir pick [options] [query]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nPick a directory from history interactively and print it, e.g. `cd (changedir pick)`. Directories are ordered and filtered the same way as by `changedir list`. Typing filters the list, space separated terms must match path components in order (see `changedir query`). With --tilde directories are shown relative to $HOME, but the picked directory is always printed in full. Exits with status 1 if cancelled.\n"))
+		printListOptionsHelp(cmd)
+		fmt.Fprintf(cmd.Output(), "\nKeys:\n")
+		fmt.Fprintf(cmd.Output(), "  enter               print the selected directory and exit\n")
+		fmt.Fprintf(cmd.Output(), "  esc, ctrl-c         cancel\n")
+		fmt.Fprintf(cmd.Output(), "  up, ctrl-p, ctrl-k  move selection up\n")
+		fmt.Fprintf(cmd.Output(), "  down, ctrl-n        move selection down\n")
+		fmt.Fprintf(cmd.Output(), "  pgup, pgdown        move selection by 10 entries\n")
+		fmt.Fprintf(cmd.Output(), "  ctrl-u              clear the query\n")
+		fmt.Fprintf(cmd.Output(), "  ctrl-d              remove the selected directory from history\n")
+		fmt.Fprintf(cmd.Output(), "  ctrl-x              add an ignore rule for the selected directory and its\n")
+		fmt.Fprintf(cmd.Output(), "                      subdirectories, and apply it\n")
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	list := options.Load(db)
+	tty := fatalr(os.OpenFile("/dev/tty", os.O_RDWR, 0))
+	defer tty.Close()
+	p := &Picker{
+		db:    db,
+		tty:   tty,
+		home:  options.Home(),
+		all:   list,
+		query: []byte(strings.Join(cmd.Args(), " ")),
+	}
+	path, ok, err := p.run()
+	fatal(err)
+	if !ok {
+		os.Exit(1)
+	}
+	fmt.Println(path)
+}
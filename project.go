@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var DEFAULT_PROJECT_MARKERS = []string{".git", "go.mod", "package.json", "Cargo.toml"}
+
+func parseProjectMarkers(s string) ([]string, error) {
+	var out []string
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if strings.ContainsRune(m, '/') || m == "." || m == ".." {
+			return nil, fmt.Errorf("Invalid project marker %q, please, use file or directory names", m)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func validateProjectMarkers(v string) error {
+	_, err := parseProjectMarkers(v)
+	return err
+}
+
+// getProjectMarkers returns markers from project.markers config or the
+// default ones.
+func getProjectMarkers(tx *bbolt.Tx) []string {
+	v := getConfig(tx, "project.markers")
+	if v == "" {
+		return DEFAULT_PROJECT_MARKERS
+	}
+	markers, err := parseProjectMarkers(v)
+	if err != nil {
+		return DEFAULT_PROJECT_MARKERS
+	}
+	return markers
+}
+
+// findProjectRoot returns the closest directory containing one of the markers,
+// starting from dir itself and going up. $HOME and the root directory are
+// never considered to be project roots (e.g. home directory in git). Returns
+// an empty string if there is no project root.
+func findProjectRoot(dir string, markers []string) string {
+	home := homeDir()
+	for {
+		if dir == "/" || dir == home || dir == "." || dir == "" {
+			return ""
+		}
+		for _, m := range markers {
+			if _, err := os.Lstat(filepath.Join(dir, m)); err == nil {
+				return dir
+			}
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// collapseProjects replaces entries with their project roots. Access time of
+// a root is the most recent access time of its entries, visits are added up.
+// Entries which don't belong to any project are omitted.
+func collapseProjects(list []DirectoryEntry) []DirectoryEntry {
+	roots := map[string]*DirectoryEntry{}
+	for i := range list {
+		e := &list[i]
+		if e.Project == "" {
+			continue
+		}
+		r := roots[e.Project]
+		if r == nil {
+			r = &DirectoryEntry{Path: []byte(e.Project), Project: e.Project}
+			roots[e.Project] = r
+		}
+		mergeVisits(r, e)
+	}
+	out := make([]DirectoryEntry, 0, len(roots))
+	for _, r := range roots {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return string(out[i].Path) < string(out[j].Path)
+	})
+	return out
+}
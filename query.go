@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Directories where the last term matches the basename are ranked this many
+// times higher.
+const QUERY_BASENAME_WEIGHT = 4
+
+// QueryMatcher matches paths against z-style query terms. Terms must match in
+// order, each one in a later path component than the previous one. Matching
+// is case insensitive unless one of the terms contains an upper case letter.
+type QueryMatcher struct {
+	terms      []string
+	ignoreCase bool
+}
+
+func newQueryMatcher(terms []string) *QueryMatcher {
+	m := &QueryMatcher{ignoreCase: true}
+	for _, t := range terms {
+		if t == "" {
+			continue
+		}
+		if strings.ToLower(t) != t {
+			m.ignoreCase = false
+		}
+		m.terms = append(m.terms, t)
+	}
+	return m
+}
+
+// Match reports whether the path matches all terms and whether the last term
+// matches the basename of the path.
+func (m *QueryMatcher) Match(path string) (ok bool, basename bool) {
+	if len(m.terms) == 0 {
+		return true, false
+	}
+	if m.ignoreCase {
+		path = strings.ToLower(path)
+	}
+	pos := 0
+	for i, t := range m.terms {
+		idx := strings.Index(path[pos:], t)
+		if idx == -1 {
+			return false, false
+		}
+		if i == len(m.terms)-1 {
+			start := strings.LastIndexByte(path, '/') + 1
+			if start < pos {
+				start = pos
+			}
+			return true, strings.Contains(path[start:], t)
+		}
+		end := pos + idx + len(t)
+		next := strings.IndexByte(path[end:], '/')
+		if next == -1 {
+			return false, false
+		}
+		pos = end + next
+	}
+	panic("unreachable")
+}
+
+type QueryResult struct {
+	Entry DirectoryEntry
+	Score float64
+}
+
+// rankQuery returns entries matching the query, best matches first. The score
+// is the frecency of an entry weighted by QUERY_BASENAME_WEIGHT.
+func rankQuery(list []DirectoryEntry, m *QueryMatcher, now time.Time) []QueryResult {
+	var out []QueryResult
+	for _, e := range list {
+		ok, basename := m.Match(string(e.Path))
+		if !ok {
+			continue
+		}
+		score := e.Frecency(now)
+		if basename {
+			score *= QUERY_BASENAME_WEIGHT
+		}
+		out = append(out, QueryResult{Entry: e, Score: score})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := &out[i], &out[j]
+		if a.Score == b.Score {
+			return a.Entry.AccessTime.After(b.Entry.AccessTime)
+		}
+		return a.Score > b.Score
+	})
+	return out
+}
+
+func commandQuery(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir query", flag.ExitOnError)
+	all := cmd.Bool("all", false, "print all matching directories, best match first (the same ones are skipped)")
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir query [options] <term>...\n")
+		fmt.Fprintf(cmd.Output(), ww("\nPrint the directory from history which matches the terms best, e.g. `cd (changedir query src foo)`. Terms must match path components in order, matching is case insensitive unless a term contains an upper case letter. Matches are ranked by frecency, directories where the last term matches the basename are preferred. The current directory and directories which no longer exist are skipped. Exits with status 1 if nothing matches.\n"))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	results := rankQuery(getDirectoryList(db), newQueryMatcher(cmd.Args()), time.Now())
+	cwd, _ := os.Getwd()
+	w := bufio.NewWriter(os.Stdout)
+	found := false
+	for _, r := range results {
+		path := string(r.Entry.Path)
+		if path == cwd {
+			continue
+		}
+		if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+			continue
+		}
+		fatalr(w.WriteString(path))
+		fatal(w.WriteByte('\n'))
+		found = true
+		if !*all {
+			break
+		}
+	}
+	fatal(w.Flush())
+	if !found {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryMatcherMatch(t *testing.T) {
+	tests := []struct {
+		terms    string
+		path     string
+		ok       bool
+		basename bool
+	}{
+		{"", "/a/b", true, false},
+		{"foo", "/src/foo", true, true},
+		{"foo", "/foo/bar", true, false},
+		{"src foo", "/home/src/foo", true, true},
+		{"src foo", "/home/src/x/foobar", true, true},
+		{"foo src", "/home/src/foo", false, false},
+		// terms must match in different components
+		{"sr c", "/src", false, false},
+		{"sr c", "/src/c", true, true},
+		{"foo", "/a/FOO", true, true},
+		{"Foo", "/a/foo", false, false},
+		{"Foo", "/a/Foo", true, true},
+		{"bar", "/src/foo", false, false},
+	}
+	for _, tt := range tests {
+		m := newQueryMatcher(strings.Fields(tt.terms))
+		ok, basename := m.Match(tt.path)
+		if ok != tt.ok || basename != tt.basename {
+			t.Errorf("terms %q on %q: got (%v, %v), want (%v, %v)", tt.terms, tt.path, ok, basename, tt.ok, tt.basename)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"go.etcd.io/bbolt"
+	"strconv"
+	"time"
+)
+
+// Retention policy is applied automatically during put, but not more often
+// than once per RETENTION_INTERVAL, so that put stays fast on large
+// histories.
+const RETENTION_INTERVAL = time.Hour
+
+var META_RETENTION_LAST_RUN = []byte("retention_last_run")
+
+type RetentionPolicy struct {
+	// MaxAge is zero if entries never expire.
+	MaxAge time.Duration
+	// MaxEntries is zero if the number of entries is unlimited.
+	MaxEntries int
+}
+
+func (p *RetentionPolicy) IsEmpty() bool {
+	return p.MaxAge == 0 && p.MaxEntries == 0
+}
+
+func getRetentionPolicy(tx *bbolt.Tx) (RetentionPolicy, error) {
+	var p RetentionPolicy
+	if v := getConfig(tx, "retention.max-age"); v != "" {
+		d, err := parseDuration(v)
+		if err != nil {
+			return p, err
+		}
+		p.MaxAge = d
+	}
+	if v := getConfig(tx, "retention.max-entries"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return p, err
+		}
+		p.MaxEntries = n
+	}
+	return p, nil
+}
+
+type RetentionReason int
+
+const (
+	RetentionReason_Expired RetentionReason = iota
+	RetentionReason_Excess
+)
+
+type RetentionCandidate struct {
+	Path   []byte
+	Reason RetentionReason
+}
+
+// retentionCandidates returns entries which should be removed according to the
+// policy. First expired entries are removed, then the least recently visited
+// ones until there are at most MaxEntries left. The current directory (e.g.
+// the one put has just stored) is never removed, but it counts towards
+// MaxEntries, it may be nil. The list is sorted in place.
+func retentionCandidates(list []DirectoryEntry, policy RetentionPolicy, now time.Time, current []byte) []RetentionCandidate {
+	var out []RetentionCandidate
+	sortDirectoryList(list, SortOrder_Recent, now)
+	for i := range list {
+		if current != nil && bytes.Equal(list[i].Path, current) {
+			// access times have one second precision, so there may be
+			// ties with the current directory
+			e := list[i]
+			copy(list[1:i+1], list[:i])
+			list[0] = e
+			break
+		}
+	}
+	kept := 0
+	for _, e := range list {
+		switch {
+		case current != nil && bytes.Equal(e.Path, current):
+			kept++
+		case policy.MaxAge != 0 && now.Sub(e.AccessTime) > policy.MaxAge:
+			out = append(out, RetentionCandidate{Path: e.Path, Reason: RetentionReason_Expired})
+		case policy.MaxEntries != 0 && kept >= policy.MaxEntries:
+			out = append(out, RetentionCandidate{Path: e.Path, Reason: RetentionReason_Excess})
+		default:
+			kept++
+		}
+	}
+	return out
+}
+
+// trimVisitLog removes visit log entries older than the given time.
+func trimVisitLog(tx *bbolt.Tx, before time.Time) error {
+	b := tx.Bucket(BUCKET_VISITS)
+	end := itob(timeToKeyNano(before))
+	var toRemove [][]byte
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+		toRemove = append(toRemove, k)
+	}
+	for _, k := range toRemove {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyRetentionPolicy removes directories and visit log entries according to
+// the stored retention policy. Unless force is true, it does nothing if it
+// was already applied within RETENTION_INTERVAL. The current directory is
+// kept, see retentionCandidates.
+func applyRetentionPolicy(tx *bbolt.Tx, now time.Time, force bool, current []byte) error {
+	policy, err := getRetentionPolicy(tx)
+	if err != nil || policy.IsEmpty() {
+		return err
+	}
+	meta := tx.Bucket(BUCKET_META)
+	if v := meta.Get(META_RETENTION_LAST_RUN); !force && len(v) == 8 {
+		if now.Sub(time.Unix(int64(btoi(v)), 0)) < RETENTION_INTERVAL {
+			return nil
+		}
+	}
+
+	bookmarked, err := getBookmarkedPaths(tx)
+	if err != nil {
+		return err
+	}
+	b := tx.Bucket(BUCKET_DIRECTORIES)
+	var list []DirectoryEntry
+	err = b.ForEach(func(k, v []byte) error {
+		e, err := decodeDirectoryEntry(append([]byte(nil), k...), v)
+		if err != nil {
+			return err
+		}
+		if bookmarked[string(e.Path)] {
+			return nil
+		}
+		list = append(list, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range retentionCandidates(list, policy, now, current) {
+		if err := deleteDirectoryEntry(b, c.Path); err != nil {
+			return err
+		}
+	}
+	if policy.MaxAge != 0 {
+		if err := trimVisitLog(tx, now.Add(-policy.MaxAge)); err != nil {
+			return err
+		}
+	}
+	return meta.Put(META_RETENTION_LAST_RUN, itob(uint64(now.Unix())))
+}
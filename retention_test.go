@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionCandidates(t *testing.T) {
+	now := time.Date(2023, 1, 31, 14, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	// entries are "path:age in days"
+	tests := []struct {
+		name    string
+		entries string
+		policy  RetentionPolicy
+		current string
+		want    map[string]RetentionReason
+	}{
+		{
+			name:    "empty policy",
+			entries: "/a:0 /b:100",
+			want:    map[string]RetentionReason{},
+		},
+		{
+			name:    "max age",
+			entries: "/a:0 /b:100 /c:31 /d:30",
+			policy:  RetentionPolicy{MaxAge: 30 * day},
+			want:    map[string]RetentionReason{"/b": RetentionReason_Expired, "/c": RetentionReason_Expired},
+		},
+		{
+			name:    "max entries",
+			entries: "/a:3 /b:1 /c:2 /d:0",
+			policy:  RetentionPolicy{MaxEntries: 2},
+			want:    map[string]RetentionReason{"/a": RetentionReason_Excess, "/c": RetentionReason_Excess},
+		},
+		{
+			name:    "expired entries are not counted",
+			entries: "/a:0 /b:1 /c:50 /d:2",
+			policy:  RetentionPolicy{MaxAge: 30 * day, MaxEntries: 2},
+			want:    map[string]RetentionReason{"/c": RetentionReason_Expired, "/d": RetentionReason_Excess},
+		},
+		{
+			name:    "current directory wins ties",
+			entries: "/a:0 /b:0 /c:0",
+			policy:  RetentionPolicy{MaxEntries: 1},
+			current: "/c",
+			want:    map[string]RetentionReason{"/a": RetentionReason_Excess, "/b": RetentionReason_Excess},
+		},
+		{
+			name:    "current directory is never removed",
+			entries: "/a:0 /b:1 /c:100",
+			policy:  RetentionPolicy{MaxAge: 30 * day, MaxEntries: 1},
+			current: "/c",
+			want:    map[string]RetentionReason{"/a": RetentionReason_Excess, "/b": RetentionReason_Excess},
+		},
+	}
+	for _, tt := range tests {
+		var list []DirectoryEntry
+		for _, s := range strings.Fields(tt.entries) {
+			path, age, _ := strings.Cut(s, ":")
+			days, _ := strconv.Atoi(age)
+			list = append(list, DirectoryEntry{Path: []byte(path), AccessTime: now.Add(-time.Duration(days) * day)})
+		}
+		var current []byte
+		if tt.current != "" {
+			current = []byte(tt.current)
+		}
+		got := map[string]RetentionReason{}
+		for _, c := range retentionCandidates(list, tt.policy, now, current) {
+			got[string(c.Path)] = c.Reason
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
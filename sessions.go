@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Sessions not updated for this long are removed, unless session.max-age
+// config says otherwise.
+const DEFAULT_SESSION_MAX_AGE = 7 * 24 * time.Hour
+
+// Maximum number of directories in a session stack, the oldest ones are
+// dropped.
+const SESSION_MAX_STACK = 100
+
+// SessionEntry is the navigation stack of a shell session. Stack[Pos] is the
+// current directory, directories before it can be returned to with back,
+// directories after it with forward.
+type SessionEntry struct {
+	ID      string    `json:"-"`
+	Stack   []string  `json:"stack"`
+	Pos     int       `json:"pos"`
+	Updated time.Time `json:"updated"`
+}
+
+func decodeSessionEntry(k, v []byte) (SessionEntry, error) {
+	e := SessionEntry{ID: string(k)}
+	if err := json.Unmarshal(v, &e); err != nil {
+		return e, fmt.Errorf("Bad session entry for %q: %s", k, err)
+	}
+	if e.Pos < 0 || e.Pos >= len(e.Stack) {
+		return e, fmt.Errorf("Bad session entry for %q: position out of range", k)
+	}
+	return e, nil
+}
+
+func putSessionEntry(b *bbolt.Bucket, e *SessionEntry) error {
+	v, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(e.ID), v)
+}
+
+func getSessionEntry(b *bbolt.Bucket, id string) (SessionEntry, bool, error) {
+	if v := b.Get([]byte(id)); v != nil {
+		e, err := decodeSessionEntry([]byte(id), v)
+		return e, true, err
+	}
+	return SessionEntry{ID: id}, false, nil
+}
+
+// Push makes dir the current directory of the session. Directories after the
+// current one are dropped, unless dir is the current directory already (e.g.
+// after back or forward).
+func (e *SessionEntry) Push(dir string) {
+	if len(e.Stack) > 0 && e.Stack[e.Pos] == dir {
+		return
+	}
+	if len(e.Stack) > 0 {
+		e.Stack = e.Stack[:e.Pos+1]
+	}
+	e.Stack = append(e.Stack, dir)
+	if len(e.Stack) > SESSION_MAX_STACK {
+		e.Stack = e.Stack[len(e.Stack)-SESSION_MAX_STACK:]
+	}
+	e.Pos = len(e.Stack) - 1
+}
+
+func getSessionMaxAge(tx *bbolt.Tx) (time.Duration, error) {
+	if v := getConfig(tx, "session.max-age"); v != "" {
+		return parseDuration(v)
+	}
+	return DEFAULT_SESSION_MAX_AGE, nil
+}
+
+// expireSessions removes sessions which were not updated for longer than
+// session.max-age.
+func expireSessions(tx *bbolt.Tx, now time.Time) error {
+	maxAge, err := getSessionMaxAge(tx)
+	if err != nil {
+		return err
+	}
+	b := tx.Bucket(BUCKET_SESSIONS)
+	var toRemove [][]byte
+	err = b.ForEach(func(k, v []byte) error {
+		e, err := decodeSessionEntry(k, v)
+		if err != nil || now.Sub(e.Updated) > maxAge {
+			// broken entries are of no use either
+			toRemove = append(toRemove, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range toRemove {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushSession records a visit of dir in the session stack.
+func pushSession(tx *bbolt.Tx, id, dir string, now time.Time) error {
+	if err := expireSessions(tx, now); err != nil {
+		return err
+	}
+	b := tx.Bucket(BUCKET_SESSIONS)
+	e, _, err := getSessionEntry(b, id)
+	if err != nil {
+		return err
+	}
+	e.Push(dir)
+	e.Updated = now
+	return putSessionEntry(b, &e)
+}
+
+// getSessionID returns the session id from the flag or CHANGEDIR_SESSION
+// environment variable.
+func getSessionID(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("CHANGEDIR_SESSION")
+}
+
+// moveSession moves the current position of a session by delta and prints the
+// directory at the new position. Exits with status 1 if there is nowhere to
+// move.
+func moveSession(db *bbolt.DB, id string, delta int) {
+	if id == "" {
+		fatal(fmt.Errorf("Session id is missing, please, use --session or set CHANGEDIR_SESSION environment variable"))
+	}
+	var dir string
+	fatal(db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(BUCKET_SESSIONS)
+		e, ok, err := getSessionEntry(b, id)
+		if err != nil || !ok {
+			return err
+		}
+		pos := e.Pos + delta
+		if pos < 0 {
+			pos = 0
+		}
+		if pos >= len(e.Stack) {
+			pos = len(e.Stack) - 1
+		}
+		if pos == e.Pos {
+			return nil
+		}
+		e.Pos = pos
+		e.Updated = time.Now().UTC().Truncate(time.Second)
+		dir = e.Stack[pos]
+		return putSessionEntry(b, &e)
+	}))
+	if dir == "" {
+		os.Exit(1)
+	}
+	fmt.Println(dir)
+}
+
+func commandSessionMove(db *bbolt.DB, args []string, name string, forward bool) {
+	cmd := flag.NewFlagSet("changedir "+name, flag.ExitOnError)
+	session := cmd.String("session", "", "shell session id (default is CHANGEDIR_SESSION environment variable)")
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir %s [options] [n]\n", name)
+		if forward {
+			fmt.Fprintf(cmd.Output(), ww("\nPrint the directory n steps forward (1 by default) in the navigation stack of the shell session, e.g. `cd (changedir forward)`. It's only possible to go forward after going back, visiting a new directory drops the directories after the current one.\n"))
+		} else {
+			fmt.Fprintf(cmd.Output(), ww("\nPrint the directory n steps back (1 by default) in the navigation stack of the shell session, e.g. `cd (changedir back)`.\n"))
+		}
+		fmt.Fprintf(cmd.Output(), ww("\nThe stack is recorded by `changedir put --session`, a directory is pushed unless it's the current directory of the stack already, so that changing to the printed directory keeps the stack intact. The stack holds the last 100 directories. Sessions which were not used for session.max-age config (7 days by default) are removed. Exits with status 1 if there is no such directory.\n"))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	n := 1
+	if cmd.NArg() > 0 {
+		n = fatalr(parseSessionSteps(cmd.Arg(0)))
+	}
+	if !forward {
+		n = -n
+	}
+	moveSession(db, getSessionID(*session), n)
+}
+
+func parseSessionSteps(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("Invalid number of steps %q, please, use a positive number", s)
+	}
+	return n, nil
+}
+
+func commandBack(db *bbolt.DB, args []string) {
+	commandSessionMove(db, args, "back", false)
+}
+
+func commandForward(db *bbolt.DB, args []string) {
+	commandSessionMove(db, args, "forward", true)
+}
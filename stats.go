@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Width of the longest bar in the visits per day histogram.
+const STATS_HISTOGRAM_WIDTH = 40
+
+type Stats struct {
+	Entries      int               `json:"entries"`
+	Visits       uint64            `json:"visits"`
+	LogEntries   int               `json:"log_entries"`
+	Trees        []TreeStats       `json:"trees"`
+	MostVisited  []DirectoryRecord `json:"most_visited"`
+	MostRecent   []DirectoryRecord `json:"most_recent"`
+	VisitsPerDay []DayStats        `json:"visits_per_day"`
+	FileSize     int64             `json:"file_size"`
+	Buckets      []BucketStats     `json:"buckets"`
+	FreePages    int               `json:"free_pages"`
+	PendingPages int               `json:"pending_pages"`
+}
+
+// TreeStats counts entries within a top-level directory. Directories under
+// $HOME are counted within top-level directories of $HOME instead.
+type TreeStats struct {
+	Tree    string `json:"tree"`
+	Entries int    `json:"entries"`
+	Visits  uint64 `json:"visits"`
+}
+
+type DayStats struct {
+	Date   string `json:"date"`
+	Visits int    `json:"visits"`
+}
+
+type BucketStats struct {
+	Name        string `json:"name"`
+	Keys        int    `json:"keys"`
+	Depth       int    `json:"depth"`
+	BranchPages int    `json:"branch_pages"`
+	LeafPages   int    `json:"leaf_pages"`
+	// bytes actually used by keys and values
+	LeafInuse int `json:"leaf_inuse"`
+	// bytes allocated for leaf pages
+	LeafAlloc int `json:"leaf_alloc"`
+	// small buckets are stored within their parent page and have no pages
+	// of their own
+	Inline bool `json:"inline"`
+}
+
+// treeOf returns the top-level directory of a path, see TreeStats.
+func treeOf(path, home string) string {
+	prefix := "/"
+	if home != "" && isUnder(path, home) {
+		prefix = "~/"
+		path = contractHome(path, home)
+		if path == "~" {
+			return "~"
+		}
+		path = path[2:]
+	} else {
+		path = strings.TrimPrefix(path, "/")
+	}
+	if i := strings.IndexByte(path, '/'); i != -1 {
+		path = path[:i]
+	}
+	return prefix + path
+}
+
+func getStats(db *bbolt.DB, top, days int, now time.Time) *Stats {
+	s := &Stats{}
+	list := getDirectoryList(db)
+	s.Entries = len(list)
+
+	home := homeDir()
+	trees := map[string]*TreeStats{}
+	for _, e := range list {
+		s.Visits += e.Visits
+		name := treeOf(string(e.Path), home)
+		t := trees[name]
+		if t == nil {
+			t = &TreeStats{Tree: name}
+			trees[name] = t
+		}
+		t.Entries++
+		t.Visits += e.Visits
+	}
+	for _, t := range trees {
+		s.Trees = append(s.Trees, *t)
+	}
+	sort.Slice(s.Trees, func(i, j int) bool {
+		a, b := &s.Trees[i], &s.Trees[j]
+		if a.Entries == b.Entries {
+			return a.Tree < b.Tree
+		}
+		return a.Entries > b.Entries
+	})
+
+	topOf := func(less func(a, b *DirectoryEntry) bool) []DirectoryRecord {
+		sort.SliceStable(list, func(i, j int) bool { return less(&list[i], &list[j]) })
+		out := []DirectoryRecord{}
+		for i := 0; i < len(list) && i < top; i++ {
+			out = append(out, *newDirectoryRecord(&list[i]))
+		}
+		return out
+	}
+	s.MostVisited = topOf(func(a, b *DirectoryEntry) bool {
+		if a.Visits == b.Visits {
+			return a.AccessTime.After(b.AccessTime)
+		}
+		return a.Visits > b.Visits
+	})
+	s.MostRecent = topOf(func(a, b *DirectoryEntry) bool {
+		return a.AccessTime.After(b.AccessTime)
+	})
+
+	// local midnight of the first day in the histogram
+	y, m, d := now.Date()
+	since := time.Date(y, m, d-days+1, 0, 0, 0, 0, now.Location())
+	perDay := make([]int, days)
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		s.LogEntries = tx.Bucket(BUCKET_VISITS).Stats().KeyN
+		err := forEachVisit(tx, since, time.Time{}, func(e *VisitEntry) error {
+			t := e.Time.In(now.Location())
+			y, m, d := t.Date()
+			day := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+			// days may be shorter or longer than 24h around DST changes
+			i := int((day.Sub(since) + 12*time.Hour) / (24 * time.Hour))
+			if i >= 0 && i < days {
+				perDay[i]++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, name := range ALL_BUCKETS {
+			bs := tx.Bucket(name).Stats()
+			b := BucketStats{
+				Name:        string(name),
+				Keys:        bs.KeyN,
+				Depth:       bs.Depth,
+				BranchPages: bs.BranchPageN,
+				LeafPages:   bs.LeafPageN,
+				LeafInuse:   bs.LeafInuse,
+				LeafAlloc:   bs.LeafAlloc,
+			}
+			if bs.LeafPageN == 0 && bs.InlineBucketN > 0 {
+				b.Inline = true
+				b.LeafInuse = bs.InlineBucketInuse
+			}
+			s.Buckets = append(s.Buckets, b)
+		}
+		return nil
+	}))
+	s.VisitsPerDay = make([]DayStats, days)
+	for i := range perDay {
+		s.VisitsPerDay[i] = DayStats{
+			Date:   since.AddDate(0, 0, i).Format("2006-01-02"),
+			Visits: perDay[i],
+		}
+	}
+
+	dbStats := db.Stats()
+	s.FreePages = dbStats.FreePageN
+	s.PendingPages = dbStats.PendingPageN
+	if fi, err := os.Stat(db.Path()); err == nil {
+		s.FileSize = fi.Size()
+	}
+	return s
+}
+
+func writeStatsText(w *bufio.Writer, s *Stats) {
+	fmt.Fprintf(w, "Entries:     %d\n", s.Entries)
+	fmt.Fprintf(w, "Visits:      %d\n", s.Visits)
+	fmt.Fprintf(w, "Log entries: %d\n", s.LogEntries)
+
+	fmt.Fprintf(w, "\nEntries per tree:\n")
+	for _, t := range s.Trees {
+		fmt.Fprintf(w, "  %6d %8d  %s\n", t.Entries, t.Visits, t.Tree)
+	}
+
+	fmt.Fprintf(w, "\nMost visited:\n")
+	for _, r := range s.MostVisited {
+		fmt.Fprintf(w, "  %6d  %s\n", r.Visits, r.Path)
+	}
+
+	fmt.Fprintf(w, "\nMost recent:\n")
+	for _, r := range s.MostRecent {
+		fmt.Fprintf(w, "  %s  %s\n", r.AccessTime.Local().Format("2006-01-02 15:04"), r.Path)
+	}
+
+	fmt.Fprintf(w, "\nVisits per day:\n")
+	maxVisits := 0
+	for _, d := range s.VisitsPerDay {
+		if d.Visits > maxVisits {
+			maxVisits = d.Visits
+		}
+	}
+	for _, d := range s.VisitsPerDay {
+		bar := 0
+		if maxVisits > 0 {
+			bar = (d.Visits*STATS_HISTOGRAM_WIDTH + maxVisits - 1) / maxVisits
+		}
+		fmt.Fprintf(w, "  %s %6d %s\n", d.Date, d.Visits, strings.Repeat("#", bar))
+	}
+
+	fmt.Fprintf(w, "\nDatabase:\n")
+	fmt.Fprintf(w, "  file size:     %d bytes\n", s.FileSize)
+	fmt.Fprintf(w, "  free pages:    %d\n", s.FreePages)
+	fmt.Fprintf(w, "  pending pages: %d\n", s.PendingPages)
+	fmt.Fprintf(w, "\nBuckets:\n")
+	fmt.Fprintf(w, "  %-12s %8s %6s %8s %8s %10s %10s\n", "name", "keys", "depth", "branch", "leaf", "inuse", "alloc")
+	for _, b := range s.Buckets {
+		fmt.Fprintf(w, "  %-12s %8d %6d %8d %8d %10d %10d", b.Name, b.Keys, b.Depth, b.BranchPages, b.LeafPages, b.LeafInuse, b.LeafAlloc)
+		if b.Inline {
+			fmt.Fprintf(w, "  (inline)")
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func commandStats(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir stats", flag.ExitOnError)
+	format := cmd.String("format", "text", "output format: \"text\" or \"json\"")
+	top := cmd.Int("top", 10, "number of most visited and most recent directories to show")
+	days := cmd.Int("days", 14, "number of days in the visits per day histogram")
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir stats [options]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nShow statistics about the history: number of entries and visits, entries and visits per top-level directory (directories under $HOME are grouped by top-level directories of $HOME), most visited and most recent directories, visits per day from the visit log and database storage details. Page counts and sizes of buckets come from bbolt, \"inuse\" is the number of bytes used by keys and values, \"alloc\" is the number of bytes allocated for leaf pages. Small buckets are stored inline within the parent page and don't have pages of their own.\n"))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		fatal(fmt.Errorf("Unknown format %q, please, use \"text\" or \"json\"", *format))
+	}
+	if *days < 1 {
+		fatal(fmt.Errorf("Number of days must be positive"))
+	}
+
+	s := getStats(db, *top, *days, time.Now())
+	w := bufio.NewWriter(os.Stdout)
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		fatal(enc.Encode(s))
+	} else {
+		writeStatsText(w, s)
+	}
+	fatal(w.Flush())
+}
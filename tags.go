@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stringList is a flag which can be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func validateTag(tag string) error {
+	if tag == "" || strings.ContainsAny(tag, ", \t\n") {
+		return fmt.Errorf("Invalid tag %q, it must be non-empty and contain no commas or whitespace", tag)
+	}
+	return nil
+}
+
+// unionTags returns sorted tags which are present in either a or b.
+func unionTags(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, list := range [][]string{a, b} {
+		for _, t := range list {
+			if !seen[t] {
+				seen[t] = true
+				out = append(out, t)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (e *DirectoryEntry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *DirectoryEntry) HasAllTags(tags []string) bool {
+	for _, t := range tags {
+		if !e.HasTag(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// updateTags modifies tags of a history entry with fn. If create is true, a
+// missing entry is created with no visits, otherwise it's an error.
+func updateTags(db *bbolt.DB, dir string, create bool, fn func(e *DirectoryEntry)) {
+	fatal(db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(BUCKET_DIRECTORIES)
+		e, ok, err := getDirectoryEntry(b, []byte(dir))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if !create {
+				return fmt.Errorf("Directory %q is not in history", dir)
+			}
+			e.AccessTime = time.Now().UTC().Truncate(time.Second)
+			e.Project = findProjectRoot(dir, getProjectMarkers(tx))
+		}
+		fn(&e)
+		return putDirectoryEntry(b, &e)
+	}))
+}
+
+func commandTagAdd(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir tag add", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir tag add <directory> <tag>...\n")
+		fmt.Fprintf(cmd.Output(), ww("\nAttach tags to a directory. If the directory is not in history, it's added with no visits. Tags are kept when the directory is visited again, use `changedir list --tag` to list directories with a tag.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if cmd.NArg() < 2 {
+		cmd.Usage()
+		return
+	}
+	tags := cmd.Args()[1:]
+	for _, t := range tags {
+		fatal(validateTag(t))
+	}
+	dir := fatalr(canonicalPath(cmd.Arg(0), getResolveSymlinks(db)))
+	updateTags(db, dir, true, func(e *DirectoryEntry) {
+		e.Tags = unionTags(e.Tags, tags)
+	})
+}
+
+func commandTagRemove(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir tag remove", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir tag remove <directory> <tag>...\n")
+		fmt.Fprintf(cmd.Output(), ww("\nRemove tags from a directory in history.\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if cmd.NArg() < 2 {
+		cmd.Usage()
+		return
+	}
+	remove := map[string]bool{}
+	for _, t := range cmd.Args()[1:] {
+		remove[t] = true
+	}
+	dir := fatalr(canonicalPath(cmd.Arg(0), getResolveSymlinks(db)))
+	updateTags(db, dir, false, func(e *DirectoryEntry) {
+		tags := e.Tags[:0]
+		for _, t := range e.Tags {
+			if !remove[t] {
+				tags = append(tags, t)
+			}
+		}
+		e.Tags = tags
+	})
+}
+
+func commandTagList(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir tag list", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir tag list [directory]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nList tags of a directory, one per line. If directory is missing, list all tags with the number of tagged directories (tab separated).\n"))
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	w := bufio.NewWriter(os.Stdout)
+	if cmd.Arg(0) != "" {
+		dir := fatalr(canonicalPath(cmd.Arg(0), getResolveSymlinks(db)))
+		fatal(db.View(func(tx *bbolt.Tx) error {
+			e, ok, err := getDirectoryEntry(tx.Bucket(BUCKET_DIRECTORIES), []byte(dir))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("Directory %q is not in history", dir)
+			}
+			for _, t := range e.Tags {
+				fatalr(w.WriteString(t))
+				fatal(w.WriteByte('\n'))
+			}
+			return nil
+		}))
+		fatal(w.Flush())
+		return
+	}
+
+	counts := map[string]int{}
+	for _, e := range getDirectoryList(db) {
+		for _, t := range e.Tags {
+			counts[t]++
+		}
+	}
+	tags := make([]string, 0, len(counts))
+	for t := range counts {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	for _, t := range tags {
+		fmt.Fprintf(w, "%s\t%d\n", t, counts[t])
+	}
+	fatal(w.Flush())
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+	"y": 365 * 24 * time.Hour,
+}
+
+// parseDuration accepts a number followed by one of the units: s, m, h, d, w
+// or y (e.g. "90m", "180d", "2w"). Unlike time.ParseDuration, days, weeks and
+// years are supported and units can't be combined.
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i <= 0 {
+		return 0, fmt.Errorf("Invalid duration %q, expected a number followed by one of s, m, h, d, w, y", s)
+	}
+	unit, ok := durationUnits[s[i:]]
+	if !ok {
+		return 0, fmt.Errorf("Invalid duration %q, expected a number followed by one of s, m, h, d, w, y", s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid duration %q: %s", s, err)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTimeArg parses a point in time given on the command line. It is either
+// a duration relative to now (e.g. "3d" means three days ago) or a date with
+// optional time in local timezone (e.g. "2023-01-31" or "2023-01-31 14:00").
+func parseTimeArg(s string, now time.Time) (time.Time, error) {
+	if d, err := parseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid time %q, expected a duration (e.g. \"3d\") or a date (e.g. \"2023-01-31 14:00\")", s)
+}
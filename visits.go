@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"os"
+	"time"
+)
+
+// Visit log keys are the visit time in unix nanoseconds followed by a
+// sequence number, both big endian, so that the keys are sorted by time and
+// never collide.
+func visitKey(t time.Time, seq uint64) []byte {
+	return append(itob(timeToKeyNano(t)), itob(seq)...)
+}
+
+func timeToKeyNano(t time.Time) uint64 {
+	if n := t.UnixNano(); n > 0 {
+		return uint64(n)
+	}
+	return 0
+}
+
+func putVisitEntry(b *bbolt.Bucket, e *VisitEntry) error {
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	stored := *e
+	if isHomeRelative(b.Tx()) {
+		stored.Path = contractHome(e.Path, homeDir())
+	}
+	v, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	return b.Put(visitKey(e.Time, seq), v)
+}
+
+func decodeVisitEntry(k, v []byte) (VisitEntry, error) {
+	var e VisitEntry
+	if len(k) != 16 {
+		return e, fmt.Errorf("Bad visit log key: %x", k)
+	}
+	if err := json.Unmarshal(v, &e); err != nil {
+		return e, fmt.Errorf("Bad visit log entry: %s", err)
+	}
+	e.Path = expandHome(e.Path, homeDir())
+	e.Time = time.Unix(0, int64(btoi(k[:8]))).UTC()
+	return e, nil
+}
+
+// forEachVisit calls fn for every visit within the [since, until] time range
+// in chronological order. Zero time means the range is not limited from that
+// side.
+func forEachVisit(tx *bbolt.Tx, since, until time.Time, fn func(e *VisitEntry) error) error {
+	c := tx.Bucket(BUCKET_VISITS).Cursor()
+	for k, v := c.Seek(itob(timeToKeyNano(since))); k != nil; k, v = c.Next() {
+		e, err := decodeVisitEntry(k, v)
+		if err != nil {
+			return err
+		}
+		if !until.IsZero() && e.Time.After(until) {
+			break
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getDirectoryListInRange is similar to getDirectoryList, but access time and
+// visit counts of the entries are computed using visits within the given time
+// range only. Directories without such visits are omitted.
+func getDirectoryListInRange(db *bbolt.DB, since, until time.Time) []DirectoryEntry {
+	var out []DirectoryEntry
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		type stat struct {
+			last   time.Time
+			visits uint64
+		}
+		stats := map[string]*stat{}
+		err := forEachVisit(tx, since, until, func(e *VisitEntry) error {
+			s := stats[e.Path]
+			if s == nil {
+				s = &stat{}
+				stats[e.Path] = s
+			}
+			s.last = e.Time
+			s.visits++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		b := tx.Bucket(BUCKET_DIRECTORIES)
+		for path, s := range stats {
+			e, ok, err := getDirectoryEntry(b, []byte(path))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				// removed from history since then
+				continue
+			}
+			e.AccessTime = s.last.Truncate(time.Second)
+			e.Visits = s.visits
+			out = append(out, e)
+		}
+		return nil
+	}))
+	return out
+}
+
+func commandLog(db *bbolt.DB, args []string) {
+	cmd := flag.NewFlagSet("changedir log", flag.ExitOnError)
+	sinceString := cmd.String("since", "", "only show visits after this time (duration like \"3d\" or date like \"2023-01-31 14:00\")")
+	untilString := cmd.String("until", "", "only show visits before this time (same format as --since)")
+	session := cmd.String("session", "", "only show visits recorded with this session id")
+	showSession := cmd.Bool("show-session", false, "add session ids to output (tab separated)")
+	limit := cmd.Int("limit", 0, "show at most this many visits (0 means no limit)")
+	cmd.Usage = func() {
+		fmt.Fprintf(cmd.Output(), "Usage: changedir log [options]\n")
+		fmt.Fprintf(cmd.Output(), ww("\nShow the log of all visits, most recent first. Each line contains visit time in local timezone and a directory (tab separated). Unlike history entries, the log keeps every visit, not only the last one.\n"))
+		fmt.Fprintf(cmd.Output(), "\nOptions:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	now := time.Now()
+	var since, until time.Time
+	if *sinceString != "" {
+		since = fatalr(parseTimeArg(*sinceString, now))
+	}
+	if *untilString != "" {
+		until = fatalr(parseTimeArg(*untilString, now))
+	}
+
+	var out []VisitEntry
+	fatal(db.View(func(tx *bbolt.Tx) error {
+		return forEachVisit(tx, since, until, func(e *VisitEntry) error {
+			if *session == "" || e.Session == *session {
+				out = append(out, *e)
+			}
+			return nil
+		})
+	}))
+
+	w := bufio.NewWriter(os.Stdout)
+	for i := len(out) - 1; i >= 0; i-- {
+		if *limit > 0 && len(out)-i > *limit {
+			break
+		}
+		e := &out[i]
+		fatalr(w.WriteString(e.Time.Local().Format(time.RFC3339)))
+		fatal(w.WriteByte('\t'))
+		if *showSession {
+			if e.Session == "" {
+				fatal(w.WriteByte('-'))
+			} else {
+				fatalr(w.WriteString(e.Session))
+			}
+			fatal(w.WriteByte('\t'))
+		}
+		fatalr(w.WriteString(e.Path))
+		fatal(w.WriteByte('\n'))
+	}
+	fatal(w.Flush())
+}